@@ -0,0 +1,406 @@
+package main
+
+// This file builds the subscribe requests and turns the generated CoreCast
+// and solana_messages messages into the plain views below, which is all the
+// consumers' logic works on. The generated gRPC API is still used directly
+// for the client and the stream types in main.go (subscribe and the
+// consume* signatures), in dryrun.go and in internal/mockserver, and the
+// proto/JSON outputs (protojson, redaction) see the raw message through the
+// protoreflect API. A streaming_protobuf major version bump means updating
+// this file and those call sites, not the record and filter code.
+
+import (
+	solana_messages "github.com/bitquery/streaming_protobuf/v2/solana/messages"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+
+	"corecast-client-example/internal"
+)
+
+type currencyView struct {
+	Mint     []byte
+	Symbol   string
+	Decimals uint32
+	Native   bool
+}
+
+// The getters let a currencyView be passed wherever the proto Currency was.
+func (c currencyView) GetMintAddress() []byte { return c.Mint }
+func (c currencyView) GetSymbol() string      { return c.Symbol }
+func (c currencyView) GetNative() bool        { return c.Native }
+
+type accountView struct {
+	Address    []byte
+	TokenOwner []byte // owner of a token account, when the message carries it
+	IsSigner   bool
+}
+
+// txView holds the transaction fields the consumers use. Fields a stream
+// doesn't carry are left zero.
+type txView struct {
+	Index     uint32
+	Signature []byte
+	Signer    []byte
+	Success   bool
+	Fee       uint64
+	Accounts  []accountView
+}
+
+type tradeSideView struct {
+	Present  bool
+	Currency currencyView
+	Amount   uint64
+	Account  []byte
+}
+
+// eventKey identifies an event within its stream: the transaction signature
+// and index in its block, plus the event's position in the transaction,
+// i.e. the instruction index, the account index for balance updates, or 0
+// for whole transactions. dedup.key selects the parts used for dedup.
+type eventKey struct {
+	Signature string
+	TxIndex   uint32
+	Index     uint32
+}
+
+func newEventKey(signature []byte, txIndex, index uint32) eventKey {
+	return eventKey{Signature: string(signature), TxIndex: txIndex, Index: index}
+}
+
+// In every view below, HasBlock is false when the server sent the message
+// without a Block (Slot is then 0), and Complete is false when the message
+// lacks the event itself (e.g. a trade without Trade or with neither side);
+// consumers skip both kinds of messages. Key is used by the dedup filter. The getters used here return zero
+// values for missing submessages, so a partial message never panics.
+
+type tradeView struct {
+	Slot     uint64
+	HasBlock bool
+	Complete bool
+	Key      eventKey
+	Tx       txView
+	Buy      tradeSideView
+	Sell     tradeSideView
+	Pool     []byte
+	Program  []byte
+}
+
+type orderView struct {
+	Slot        uint64
+	HasBlock    bool
+	Complete    bool
+	Key         eventKey
+	Type        protoreflect.Enum
+	OrderID     []byte
+	BuySide     bool
+	LimitPrice  uint64
+	LimitAmount uint64
+	Account     []byte
+	Pool        []byte
+	Program     []byte
+	Base        currencyView
+	Quote       currencyView
+}
+
+type poolEventView struct {
+	Slot        uint64
+	HasBlock    bool
+	Complete    bool
+	Key         eventKey
+	BaseChange  int64
+	QuoteChange int64
+	Pool        []byte
+	Program     []byte
+	Base        currencyView
+	Quote       currencyView
+}
+
+type instructionView struct {
+	Program []byte
+	Depth   uint32
+	Data    []byte
+	Logs    []string
+}
+
+type balanceChange struct {
+	Pre  uint64
+	Post uint64
+}
+
+func (b balanceChange) GetPreBalance() uint64  { return b.Pre }
+func (b balanceChange) GetPostBalance() uint64 { return b.Post }
+
+type transactionView struct {
+	Slot           uint64
+	HasBlock       bool
+	Complete       bool
+	Key            eventKey
+	Tx             txView
+	Instructions   []instructionView
+	BalanceChanges []balanceChange
+}
+
+type transferView struct {
+	Slot             uint64
+	HasBlock         bool
+	Complete         bool
+	Key              eventKey
+	Tx               txView
+	Currency         currencyView
+	Amount           uint64
+	Sender           []byte
+	Receiver         []byte
+	InstructionIndex uint32
+}
+
+type balanceView struct {
+	Slot         uint64
+	HasBlock     bool
+	Complete     bool
+	Key          eventKey
+	Tx           txView
+	Currency     currencyView
+	AccountIndex uint32
+	Pre          uint64
+	Post         uint64
+}
+
+// protoCurrency is satisfied by the generated Currency message; its getters
+// are nil-safe, so a missing currency yields an empty view.
+type protoCurrency interface {
+	GetMintAddress() []byte
+	GetSymbol() string
+	GetDecimals() uint32
+	GetNative() bool
+}
+
+func adaptCurrency(c protoCurrency) currencyView {
+	return currencyView{Mint: c.GetMintAddress(), Symbol: c.GetSymbol(), Decimals: c.GetDecimals(), Native: c.GetNative()}
+}
+
+func adaptAccounts(accounts []*solana_messages.Account) []accountView {
+	views := make([]accountView, len(accounts))
+	for i, acc := range accounts {
+		views[i] = accountView{
+			Address:    acc.GetAddress(),
+			TokenOwner: acc.GetToken().GetOwner(),
+			IsSigner:   acc.GetIsSigner(),
+		}
+	}
+	return views
+}
+
+func recvTrade(strm proto.CoreCast_DexTradesClient) (tradeView, protobuf.Message, error) {
+	msg, err := strm.Recv()
+	if err != nil {
+		return tradeView{}, nil, err
+	}
+	buy, sell := msg.GetTrade().GetBuy(), msg.GetTrade().GetSell()
+	return tradeView{
+		Slot:     msg.GetBlock().GetSlot(),
+		HasBlock: msg.GetBlock() != nil,
+		Complete: msg.GetTrade() != nil && (buy != nil || sell != nil),
+		Key:      newEventKey(msg.GetTransaction().GetSignature(), msg.GetTransaction().GetIndex(), msg.GetTrade().GetInstructionIndex()),
+		Tx: txView{
+			Signature: msg.GetTransaction().GetSignature(),
+			Signer:    msg.GetTransaction().GetHeader().GetSigner(),
+			Success:   msg.GetTransaction().GetStatus().GetSuccess(),
+		},
+		Buy: tradeSideView{
+			Present:  buy != nil,
+			Currency: adaptCurrency(buy.GetCurrency()),
+			Amount:   buy.GetAmount(),
+			Account:  buy.GetAccount().GetAddress(),
+		},
+		Sell: tradeSideView{
+			Present:  sell != nil,
+			Currency: adaptCurrency(sell.GetCurrency()),
+			Amount:   sell.GetAmount(),
+			Account:  sell.GetAccount().GetAddress(),
+		},
+		Pool:    msg.GetTrade().GetMarket().GetMarketAddress(),
+		Program: msg.GetTrade().GetDex().GetProgramAddress(),
+	}, msg, nil
+}
+
+func recvOrder(strm proto.CoreCast_DexOrdersClient) (orderView, protobuf.Message, error) {
+	msg, err := strm.Recv()
+	if err != nil {
+		return orderView{}, nil, err
+	}
+	evt, order := msg.GetOrder(), msg.GetOrder().GetOrder()
+	base, quote := evt.GetMarket().GetBaseCurrency(), evt.GetMarket().GetQuoteCurrency()
+	return orderView{
+		Slot:        msg.GetBlock().GetSlot(),
+		HasBlock:    msg.GetBlock() != nil,
+		Complete:    order != nil,
+		Key:         newEventKey(msg.GetTransaction().GetSignature(), msg.GetTransaction().GetIndex(), evt.GetInstructionIndex()),
+		Type:        evt.GetType(),
+		OrderID:     order.GetOrderId(),
+		BuySide:     order.GetBuySide(),
+		LimitPrice:  order.GetLimitPrice(),
+		LimitAmount: order.GetLimitAmount(),
+		Account:     order.GetAccount(),
+		Pool:        evt.GetMarket().GetMarketAddress(),
+		Program:     evt.GetDex().GetProgramAddress(),
+		Base:        adaptCurrency(base),
+		Quote:       adaptCurrency(quote),
+	}, msg, nil
+}
+
+func recvPoolEvent(strm proto.CoreCast_DexPoolsClient) (poolEventView, protobuf.Message, error) {
+	msg, err := strm.Recv()
+	if err != nil {
+		return poolEventView{}, nil, err
+	}
+	evt := msg.GetPoolEvent()
+	base, quote := evt.GetMarket().GetBaseCurrency(), evt.GetMarket().GetQuoteCurrency()
+	return poolEventView{
+		Slot:        msg.GetBlock().GetSlot(),
+		HasBlock:    msg.GetBlock() != nil,
+		Complete:    evt != nil,
+		Key:         newEventKey(msg.GetTransaction().GetSignature(), msg.GetTransaction().GetIndex(), evt.GetInstructionIndex()),
+		BaseChange:  evt.GetBaseCurrency().GetChangeAmount(),
+		QuoteChange: evt.GetQuoteCurrency().GetChangeAmount(),
+		Pool:        evt.GetMarket().GetMarketAddress(),
+		Program:     evt.GetDex().GetProgramAddress(),
+		Base:        adaptCurrency(base),
+		Quote:       adaptCurrency(quote),
+	}, msg, nil
+}
+
+func recvTransaction(strm proto.CoreCast_TransactionsClient) (transactionView, protobuf.Message, error) {
+	msg, err := strm.Recv()
+	if err != nil {
+		return transactionView{}, nil, err
+	}
+	tx := msg.GetTransaction()
+	v := transactionView{
+		Slot:     msg.GetBlock().GetSlot(),
+		HasBlock: msg.GetBlock() != nil,
+		Complete: tx != nil,
+		Key:      newEventKey(tx.GetSignature(), tx.GetIndex(), 0),
+		Tx: txView{
+			Signature: tx.GetSignature(),
+			Signer:    tx.GetHeader().GetSigner(),
+			Success:   tx.GetStatus().GetSuccess(),
+			Fee:       tx.GetHeader().GetFee(),
+			Accounts:  adaptAccounts(tx.GetHeader().GetAccounts()),
+		},
+	}
+	for _, ix := range tx.GetParsedIdlInstructions() {
+		v.Instructions = append(v.Instructions, instructionView{
+			Program: ix.GetProgram().GetAddress(),
+			Depth:   ix.GetDepth(),
+			Data:    ix.GetData(),
+			Logs:    ix.GetLogs(),
+		})
+	}
+	for _, u := range tx.GetTotalBalanceUpdates() {
+		v.BalanceChanges = append(v.BalanceChanges, balanceChange{Pre: u.GetPreBalance(), Post: u.GetPostBalance()})
+	}
+	return v, msg, nil
+}
+
+func recvTransfer(strm proto.CoreCast_TransfersClient) (transferView, protobuf.Message, error) {
+	msg, err := strm.Recv()
+	if err != nil {
+		return transferView{}, nil, err
+	}
+	t := msg.GetTransfer()
+	return transferView{
+		Slot:     msg.GetBlock().GetSlot(),
+		HasBlock: msg.GetBlock() != nil,
+		Complete: t != nil,
+		Key:      newEventKey(msg.GetTransaction().GetSignature(), msg.GetTransaction().GetIndex(), t.GetInstructionIndex()),
+		Tx: txView{
+			Index:     msg.GetTransaction().GetIndex(),
+			Signature: msg.GetTransaction().GetSignature(),
+		},
+		Currency:         adaptCurrency(t.GetCurrency()),
+		Amount:           t.GetAmount(),
+		Sender:           t.GetSender().GetAddress(),
+		Receiver:         t.GetReceiver().GetAddress(),
+		InstructionIndex: t.GetInstructionIndex(),
+	}, msg, nil
+}
+
+func recvBalance(strm proto.CoreCast_BalancesClient) (balanceView, protobuf.Message, error) {
+	msg, err := strm.Recv()
+	if err != nil {
+		return balanceView{}, nil, err
+	}
+	b := msg.GetBalanceUpdate()
+	return balanceView{
+		Slot:     msg.GetBlock().GetSlot(),
+		HasBlock: msg.GetBlock() != nil,
+		Complete: b.GetBalanceUpdate() != nil,
+		Key:      newEventKey(msg.GetTransaction().GetSignature(), msg.GetTransaction().GetIndex(), b.GetBalanceUpdate().GetAccountIndex()),
+		Tx: txView{
+			Index:     msg.GetTransaction().GetIndex(),
+			Signature: msg.GetTransaction().GetSignature(),
+			Accounts:  adaptAccounts(msg.GetTransaction().GetHeader().GetAccounts()),
+		},
+		Currency:     adaptCurrency(b.GetCurrency()),
+		AccountIndex: b.GetBalanceUpdate().GetAccountIndex(),
+		Pre:          b.GetBalanceUpdate().GetPreBalance(),
+		Post:         b.GetBalanceUpdate().GetPostBalance(),
+	}, msg, nil
+}
+
+func addrFilterFromSlice(addresses []string) *proto.AddressFilter {
+	if len(addresses) == 0 {
+		return nil
+	}
+	return &proto.AddressFilter{Addresses: addresses}
+}
+
+func tradesRequest(cfg *internal.Config) *proto.SubscribeTradesRequest {
+	return &proto.SubscribeTradesRequest{
+		Program: addrFilterFromSlice(cfg.Filters.Programs),
+		Pool:    addrFilterFromSlice(cfg.Filters.Pools),
+		Token:   addrFilterFromSlice(cfg.Filters.Tokens),
+		Trader:  addrFilterFromSlice(cfg.Filters.Traders),
+	}
+}
+
+func ordersRequest(cfg *internal.Config) *proto.SubscribeOrdersRequest {
+	return &proto.SubscribeOrdersRequest{
+		Program: addrFilterFromSlice(cfg.Filters.Programs),
+		Pool:    addrFilterFromSlice(cfg.Filters.Pools),
+		Token:   addrFilterFromSlice(cfg.Filters.Tokens),
+		Trader:  addrFilterFromSlice(cfg.Filters.Traders),
+	}
+}
+
+func poolsRequest(cfg *internal.Config) *proto.SubscribePoolsRequest {
+	return &proto.SubscribePoolsRequest{
+		Program: addrFilterFromSlice(cfg.Filters.Programs),
+		Pool:    addrFilterFromSlice(cfg.Filters.Pools),
+		Token:   addrFilterFromSlice(cfg.Filters.Tokens),
+	}
+}
+
+func transactionsRequest(cfg *internal.Config) *proto.SubscribeTransactionsRequest {
+	return &proto.SubscribeTransactionsRequest{
+		Program: addrFilterFromSlice(cfg.Filters.Programs),
+		Signer:  addrFilterFromSlice(cfg.Filters.Signers),
+	}
+}
+
+func transfersRequest(cfg *internal.Config) *proto.SubscribeTransfersRequest {
+	return &proto.SubscribeTransfersRequest{
+		Sender:   addrFilterFromSlice(cfg.Filters.Senders),
+		Receiver: addrFilterFromSlice(cfg.Filters.Receivers),
+		Token:    addrFilterFromSlice(cfg.Filters.Tokens),
+	}
+}
+
+func balancesRequest(cfg *internal.Config) *proto.SubscribeBalanceUpdateRequest {
+	return &proto.SubscribeBalanceUpdateRequest{
+		Address: addrFilterFromSlice(cfg.Filters.Addresses),
+		Token:   addrFilterFromSlice(cfg.Filters.Tokens),
+	}
+}
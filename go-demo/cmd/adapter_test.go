@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func TestAddrFilterFromSlice(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		want      *proto.AddressFilter
+	}{
+		{"nil", nil, nil},
+		{"empty", []string{}, nil},
+		{"one", []string{"a"}, &proto.AddressFilter{Addresses: []string{"a"}}},
+		{"several", []string{"a", "b", "c"}, &proto.AddressFilter{Addresses: []string{"a", "b", "c"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := addrFilterFromSlice(tt.addresses)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("addrFilterFromSlice(%q) = %v, want nil", tt.addresses, got)
+				}
+				return
+			}
+			if !protobuf.Equal(got, tt.want) {
+				t.Fatalf("addrFilterFromSlice(%q) = %v, want %v", tt.addresses, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+
+	"corecast-client-example/internal"
+)
+
+// batchWriter accumulates the records written to out and writes them in one
+// go once size records are buffered, or interval after the first of them,
+// whichever comes first. Each Write is one whole record, so a batch never
+// splits one and records keep their order. Close writes out the rest;
+// records written after it go straight to out.
+type batchWriter struct {
+	out      io.Writer
+	size     int
+	interval time.Duration
+
+	mu     sync.Mutex
+	buf    []byte
+	n      int // records in buf
+	timer  *time.Timer
+	closed bool
+}
+
+// newOutputBatch returns a batchWriter over out for output.batch_size, or
+// nil when batching is off.
+func newOutputBatch(cfg *internal.Config, out io.Writer) *batchWriter {
+	if cfg.Output.BatchSize <= 1 {
+		return nil
+	}
+	return &batchWriter{out: out, size: cfg.Output.BatchSize, interval: cfg.Output.FlushInterval}
+}
+
+func (w *batchWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return w.out.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	w.n++
+	if w.n >= w.size {
+		return len(p), w.flush()
+	}
+	if w.n == 1 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.interval, w.tick)
+		} else {
+			w.timer.Reset(w.interval)
+		}
+	}
+	return len(p), nil
+}
+
+// tick flushes a batch that did not fill up within the flush interval. A
+// tick left over from a batch flushed by size may flush the next one early,
+// which is harmless.
+func (w *batchWriter) tick() {
+	w.mu.Lock()
+	err := w.flush()
+	w.mu.Unlock()
+	if err != nil {
+		log.Error("output flush", "err", err)
+	}
+}
+
+// flush writes out the buffered records. They are dropped if that fails.
+func (w *batchWriter) flush() error {
+	if w.n == 0 {
+		return nil
+	}
+	_, err := w.out.Write(w.buf)
+	w.buf, w.n = w.buf[:0], 0
+	return err
+}
+
+// pending returns the number of buffered records.
+func (w *batchWriter) pending() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.n
+}
+
+// Close writes out the buffered records. It does not close out.
+func (w *batchWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	return w.flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// blockBatcher collects the records of one slot so they can be emitted as
+// a single block record once the stream moves on to a later slot.
+type blockBatcher struct {
+	slot   uint64
+	max    int
+	events []json.RawMessage
+}
+
+// advance is called with the slot of every received message and flushes
+// the buffered block when the slot changes.
+func (c *consumer) advance(slot uint64) {
+	b := c.blocks
+	if b == nil || slot == b.slot {
+		return
+	}
+	c.flushBlock(false)
+	b.slot = slot
+}
+
+// addEvent buffers one encoded event of the current slot. A full buffer is
+// flushed as a partial block, so a slot number that never advances can't
+// grow it without bound.
+func (c *consumer) addEvent(event json.RawMessage) {
+	b := c.blocks
+	b.events = append(b.events, event)
+	if len(b.events) >= b.max {
+		c.flushBlock(true)
+	}
+}
+
+// flushBlock emits the buffered events, if any, as one block record: a
+// "Block" log line in log format, or a {"slot", "events"} JSON line in
+// protojson format.
+func (c *consumer) flushBlock(partial bool) {
+	b := c.blocks
+	if b == nil || len(b.events) == 0 {
+		return
+	}
+	defer func() { b.events = b.events[:0] }()
+
+	if c.json != nil {
+		line, err := json.Marshal(struct {
+			Slot    uint64            `json:"slot"`
+			Partial bool              `json:"partial,omitempty"`
+			Events  []json.RawMessage `json:"events"`
+		}{b.slot, partial, b.events})
+		if err == nil {
+			err = c.json.writeLine(line)
+		}
+		if err != nil {
+			log.Error("protojson write", "err", err)
+		}
+		return
+	}
+
+	events, err := json.Marshal(b.events)
+	if err != nil {
+		log.Error("block record", "err", err)
+		return
+	}
+	log.Info("Block", "Slot", b.slot, "Partial", partial, "Count", len(b.events), "Events", string(events))
+}
+
+// recordJSON encodes a console record as a JSON object with the same keys
+// as its log line, plus the line's message as "Event". Redaction is applied
+// here because the log handler only sees the top-level keys of the block.
+func (c *consumer) recordJSON(msg string, rec any) (json.RawMessage, error) {
+	ctx := project(rec, c.cfg.Output.Rename)
+	if c.redact != nil {
+		c.redact.pairs(ctx)
+	}
+	obj := make(map[string]any, len(ctx)/2+1)
+	obj["Event"] = msg
+	for i := 0; i+1 < len(ctx); i += 2 {
+		obj[fmt.Sprint(ctx[i])] = ctx[i+1]
+	}
+	return json.Marshal(obj)
+}
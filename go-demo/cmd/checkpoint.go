@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// checkpoint persists the last slot processed per stream type to a JSON
+// file, e.g. {"transfers": 312000123}, so a restarted client knows where it
+// left off. The subscribe requests have no start slot, so the stream itself
+// always resumes at the live tip; the saved slot is used to report the gap.
+type checkpoint struct {
+	path  string
+	stats *stats
+
+	mu    sync.Mutex        // the periodic save races the final one on shutdown
+	slots map[string]uint64 // loaded at startup, then the last saved values
+	from  map[string]uint64 // slot to resume after, per stream type
+}
+
+func newCheckpoint(path string, s *stats) (*checkpoint, error) {
+	cp := &checkpoint{path: path, stats: s, slots: make(map[string]uint64), from: make(map[string]uint64)}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cp.slots); err != nil {
+		return nil, err
+	}
+	log.Info("checkpoint loaded", "path", path, "slots", cp.slots)
+	return cp, nil
+}
+
+// resume logs the slot each stream would resume from: the checkpoint, or
+// stream.from_slot for a stream without one. The server can't start from
+// it, so the slots up to the first one received are reported as missed.
+func (cp *checkpoint) resume(streamTypes []string, fromSlot uint64) {
+	for _, streamType := range streamTypes {
+		from := fromSlot
+		if cp != nil && cp.slots[streamType] > 0 {
+			from = cp.slots[streamType]
+		}
+		if from == 0 {
+			continue
+		}
+		if cp != nil {
+			cp.from[streamType] = from
+		}
+		log.Warn("the CoreCast API can't start a stream at a past slot, streaming from the live tip instead",
+			"stream", streamType, "from_slot", from)
+	}
+}
+
+// run saves the checkpoint every interval until ctx is cancelled. The
+// final save on shutdown is up to the caller.
+func (cp *checkpoint) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cp.reportGaps()
+			if err := cp.save(); err != nil {
+				log.Error("checkpoint save", "path", cp.path, "err", err)
+			}
+		}
+	}
+}
+
+// reportGaps logs, once per stream, the slots between the resume slot and
+// the first slot received after startup.
+func (cp *checkpoint) reportGaps() {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for streamType, from := range cp.from {
+		first := cp.stats.snapshot().Streams[streamType].FirstSlot
+		if first == 0 {
+			continue
+		}
+		if first > from+1 {
+			log.Warn("slots missed since the checkpoint", "stream", streamType,
+				"from_slot", from, "first_slot", first, "missed", first-from-1)
+		}
+		delete(cp.from, streamType)
+	}
+}
+
+// save writes the last slot of every stream that has received one, keeping
+// the loaded value for the others. The file is replaced atomically so a
+// crash mid-write can't leave it truncated.
+func (cp *checkpoint) save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	changed := false
+	for streamType, st := range cp.stats.snapshot().Streams {
+		if st.LastSlot > cp.slots[streamType] {
+			cp.slots[streamType] = st.LastSlot
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	b, err := json.Marshal(cp.slots)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cp.path), filepath.Base(cp.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), cp.path)
+}
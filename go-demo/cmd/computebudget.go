@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/mr-tron/base58"
+)
+
+const (
+	computeBudgetProgram = "ComputeBudget111111111111111111111111111111"
+
+	// Runtime defaults applied when a transaction doesn't set its own limit.
+	defaultUnitsPerInstruction = 200_000
+	maxComputeUnitLimit        = 1_400_000
+
+	// ComputeBudget instruction discriminators (first data byte).
+	setComputeUnitLimit = 2
+	setComputeUnitPrice = 3
+)
+
+// computeBudget accumulates the compute budget settings of a transaction
+// from its top-level instructions.
+type computeBudget struct {
+	limit    uint32
+	price    uint64 // micro-lamports per compute unit
+	hasLimit bool
+	hasPrice bool
+	other    int // top-level instructions of other programs
+}
+
+func (b *computeBudget) add(program []byte, topLevel bool, data []byte) {
+	if !topLevel {
+		return
+	}
+	if base58.Encode(program) != computeBudgetProgram {
+		b.other++
+		return
+	}
+	switch {
+	case len(data) >= 5 && data[0] == setComputeUnitLimit:
+		b.limit, b.hasLimit = binary.LittleEndian.Uint32(data[1:5]), true
+	case len(data) >= 9 && data[0] == setComputeUnitPrice:
+		b.price, b.hasPrice = binary.LittleEndian.Uint64(data[1:9]), true
+	}
+}
+
+// explicit reports whether the transaction carried any compute budget instruction.
+func (b *computeBudget) explicit() bool {
+	return b.hasLimit || b.hasPrice
+}
+
+// unitLimit is the requested limit, or the runtime default of 200k units per
+// non-compute-budget instruction capped at 1.4M.
+func (b *computeBudget) unitLimit() uint32 {
+	if b.hasLimit {
+		return b.limit
+	}
+	return uint32(min(b.other*defaultUnitsPerInstruction, maxComputeUnitLimit))
+}
+
+// priorityFee is the prioritization fee in lamports: limit * price, rounded up.
+// Without a SetComputeUnitPrice instruction the price, and the fee, is zero.
+func (b *computeBudget) priorityFee() uint64 {
+	return (uint64(b.unitLimit())*b.price + 999_999) / 1_000_000
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// csvColumns are the columns of output.format: csv, each with the swap
+// record key it is taken from, which output.redact.fields matches on.
+// Amounts are the decimal values, normalized by the mint's decimals.
+var csvColumns = []struct{ header, key string }{
+	{"slot", "Slot"},
+	{"signature", "Signature"},
+	{"sell_mint", "Sell"},
+	{"buy_mint", "Buy"},
+	{"sell_amount", "SellValue"},
+	{"buy_amount", "BuyValue"},
+	{"account", "Account"},
+	{"pool", "Pool"},
+	{"program", "Program"},
+}
+
+// csvWriter writes dex trades as CSV rows under a header line. Rows are
+// buffered; Close flushes them. With flushRows every row is passed on to out
+// by itself, for a batchWriter to batch.
+type csvWriter struct {
+	mu        sync.Mutex
+	w         *csv.Writer
+	flushRows bool
+}
+
+func newCSVWriter(out io.Writer, flushRows bool) (*csvWriter, error) {
+	w := &csvWriter{w: csv.NewWriter(out), flushRows: flushRows}
+	header := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		header[i] = col.header
+	}
+	if err := w.w.Write(header); err != nil {
+		return nil, err
+	}
+	if flushRows {
+		w.w.Flush()
+	}
+	return w, nil
+}
+
+// write appends one row. The values go through the redactor, if any, by
+// their record key, the same as on the console.
+func (w *csvWriter) write(swap swapRecord, r *redactor) error {
+	values := map[string]string{
+		"Slot":      strconv.FormatUint(swap.Slot, 10),
+		"Signature": swap.Signature,
+		"Sell":      swap.Sell,
+		"Buy":       swap.Buy,
+		"SellValue": swap.SellValue,
+		"BuyValue":  swap.BuyValue,
+		"Account":   swap.Account,
+		"Pool":      swap.Pool,
+		"Program":   swap.Program,
+	}
+	ctx := make([]any, 0, 2*len(csvColumns))
+	for _, col := range csvColumns {
+		ctx = append(ctx, col.key, values[col.key])
+	}
+	if r != nil {
+		r.pairs(ctx)
+	}
+	row := make([]string, 0, len(csvColumns))
+	for i := 1; i < len(ctx); i += 2 {
+		row = append(row, fmt.Sprint(ctx[i]))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Write(row); err != nil || !w.flushRows {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Close flushes the buffered rows.
+func (w *csvWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// writeCSV is the sink of output.format: csv. Trades become rows; the
+// client's own records, such as analyzer findings, go to the log.
+func (c *consumer) writeCSV(_ string, rec record) error {
+	recs := rec.console()
+	if rec.msg == nil {
+		for _, r := range recs {
+			c.logRecord(r.name, r.fields)
+		}
+		return nil
+	}
+	var swap swapRecord
+	switch r := recs[0].fields.(type) {
+	case swapRecord:
+		swap = r
+	case firstTradeRecord:
+		swap = r.swapRecord
+	default:
+		return fmt.Errorf("csv write: no row for a %s record", recs[0].name)
+	}
+	if err := c.csv.write(swap, c.redact); err != nil {
+		return fmt.Errorf("csv write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const dashboardRefresh = time.Second
+
+// dashboard redraws a live summary of the stats in place on a terminal.
+type dashboard struct {
+	out   io.Writer
+	stats *stats
+	start time.Time
+
+	mu        sync.Mutex
+	lastError string
+	prev      statsSnapshot
+	prevAt    time.Time
+}
+
+func newDashboard(out io.Writer, s *stats) *dashboard {
+	now := time.Now()
+	return &dashboard{out: out, stats: s, start: now, prevAt: now}
+}
+
+// logHandler replaces the regular log output while the dashboard owns the
+// terminal: warnings and errors are counted, everything else is dropped.
+func (d *dashboard) logHandler() log.Handler {
+	return log.FuncHandler(func(r *log.Record) error {
+		if r.Lvl > log.LvlWarn {
+			return nil
+		}
+		d.stats.error()
+		d.mu.Lock()
+		d.lastError = fmt.Sprintf("%s %s %v", r.Time.Format("15:04:05"), r.Msg, r.Ctx)
+		d.mu.Unlock()
+		return nil
+	})
+}
+
+func (d *dashboard) run(ctx context.Context) {
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		d.render()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *dashboard) render() {
+	now := time.Now()
+	snap := d.stats.snapshot()
+	elapsed := now.Sub(d.prevAt).Seconds()
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J") // cursor home, clear screen
+	fmt.Fprintf(&b, "CoreCast stream dashboard   uptime %s   (Ctrl+C to stop)\n\n", now.Sub(d.start).Truncate(time.Second))
+	fmt.Fprintf(&b, "%-14s %12s %10s %12s %10s\n", "STREAM", "MESSAGES", "MSG/S", "LAST SLOT", "IDLE")
+
+	names := make([]string, 0, len(snap.Streams))
+	for name := range snap.Streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st := snap.Streams[name]
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(st.Messages-d.prev.Streams[name].Messages) / elapsed
+		}
+		fmt.Fprintf(&b, "%-14s %12d %10.1f %12d %10s\n",
+			name, st.Messages, rate, st.LastSlot, now.Sub(st.LastMessage).Truncate(time.Second))
+	}
+
+	b.WriteString("\nTOP TOKENS\n")
+	for i, t := range d.stats.topTokens(10) {
+		fmt.Fprintf(&b, "%2d. %-44s %10d\n", i+1, t.Mint, t.Count)
+	}
+
+	d.mu.Lock()
+	fmt.Fprintf(&b, "\nERRORS/WARNINGS %d\n", snap.Errors)
+	if snap.Oversize > 0 {
+		fmt.Fprintf(&b, "oversize messages: %d (raise tuning.max_recv_msg_size)\n", snap.Oversize)
+	}
+	if d.lastError != "" {
+		fmt.Fprintf(&b, "last: %s\n", d.lastError)
+	}
+	d.mu.Unlock()
+
+	d.prev, d.prevAt = snap, now
+	io.WriteString(d.out, b.String())
+}
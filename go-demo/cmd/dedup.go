@@ -0,0 +1,69 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+
+	"corecast-client-example/internal"
+)
+
+// dedupKey is an event key qualified by its stream type, since a trade and
+// a transfer of the same instruction share signature and index.
+type dedupKey struct {
+	stream string
+	eventKey
+}
+
+// dedupFilter drops events already seen among the last size ones, e.g. the
+// ones a server replays after the client re-subscribes. It is an LRU: a
+// repeated key counts as recent again.
+type dedupFilter struct {
+	mu    sync.Mutex // shared by the consumers of all stream types
+	size  int
+	modes map[string]string // dedup.key per stream type
+	order *list.List        // of dedupKey, most recent first
+	keys  map[dedupKey]*list.Element
+	stats *stats
+}
+
+func newDedupFilter(size int, modes map[string]string, s *stats) *dedupFilter {
+	if size <= 0 {
+		return nil
+	}
+	return &dedupFilter{size: size, modes: modes, order: list.New(), keys: make(map[dedupKey]*list.Element, size), stats: s}
+}
+
+// keyFor reduces key to the parts dedup.key selects for stream.
+func (d *dedupFilter) keyFor(stream string, key eventKey) dedupKey {
+	switch d.modes[stream] {
+	case internal.DedupSignature:
+		key = eventKey{Signature: key.Signature}
+	case internal.DedupInstruction:
+		key.TxIndex = 0
+	}
+	return dedupKey{stream, key}
+}
+
+// duplicate reports whether the event was already seen, and counts it if
+// so. Events without a signature are never considered duplicates.
+func (d *dedupFilter) duplicate(stream string, key eventKey) bool {
+	if d == nil || key.Signature == "" {
+		return false
+	}
+	k := d.keyFor(stream, key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.keys[k]; ok {
+		d.order.MoveToFront(e)
+		d.stats.duplicate()
+		return true
+	}
+	d.keys[k] = d.order.PushFront(k)
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.keys, oldest.Value.(dedupKey))
+	}
+	return false
+}
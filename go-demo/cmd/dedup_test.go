@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"corecast-client-example/internal"
+)
+
+func TestDedupKey(t *testing.T) {
+	first := eventKey{Signature: "sig", TxIndex: 7, Index: 1}
+	tests := []struct {
+		mode string
+		next eventKey
+		dup  bool
+	}{
+		{internal.DedupSignature, eventKey{Signature: "sig", TxIndex: 7, Index: 2}, true},
+		{internal.DedupSignature, eventKey{Signature: "other", TxIndex: 7, Index: 1}, false},
+		{internal.DedupInstruction, eventKey{Signature: "sig", TxIndex: 7, Index: 1}, true},
+		{internal.DedupInstruction, eventKey{Signature: "sig", TxIndex: 8, Index: 1}, true},
+		{internal.DedupInstruction, eventKey{Signature: "sig", TxIndex: 7, Index: 2}, false},
+		{internal.DedupAccount, eventKey{Signature: "sig", TxIndex: 7, Index: 1}, true},
+		{internal.DedupAccount, eventKey{Signature: "sig", TxIndex: 8, Index: 1}, false},
+		{internal.DedupAccount, eventKey{Signature: "sig", TxIndex: 7, Index: 2}, false},
+	}
+	for _, tt := range tests {
+		d := newDedupFilter(10, map[string]string{"balances": tt.mode}, newStats())
+		if d.duplicate("balances", first) {
+			t.Fatalf("%s: first event reported as a duplicate", tt.mode)
+		}
+		if got := d.duplicate("balances", tt.next); got != tt.dup {
+			t.Errorf("%s: duplicate(%+v) after %+v = %v, want %v", tt.mode, tt.next, first, got, tt.dup)
+		}
+		if d.duplicate("transfers", first) {
+			t.Errorf("%s: an event of another stream type reported as a duplicate", tt.mode)
+		}
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	d := newDedupFilter(2, nil, newStats())
+	a, b, c := eventKey{Signature: "a"}, eventKey{Signature: "b"}, eventKey{Signature: "c"}
+	for _, k := range []eventKey{a, b, c} {
+		d.duplicate("transfers", k)
+	}
+	if d.duplicate("transfers", a) {
+		t.Error("an event older than the window was dropped")
+	}
+	if !d.duplicate("transfers", c) {
+		t.Error("an event within the window was kept")
+	}
+	if d.duplicate("transfers", eventKey{}) {
+		t.Error("an event without signature was dropped")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"corecast-client-example/internal"
+)
+
+// dryRun subscribes to every configured stream type and waits up to
+// timeout for its first message, without consuming the stream. A stream
+// that is accepted but sends nothing in time also passes: the dial, TLS,
+// authorization and request were all accepted by then.
+func dryRun(ctx context.Context, client proto.CoreCastClient, cfg *internal.Config, timeout time.Duration) error {
+	var errs []error
+	for _, streamType := range cfg.StreamTypes() {
+		start := time.Now()
+		slot, err := probe(ctx, client, cfg, streamType, timeout)
+		switch {
+		case err == nil:
+			log.Info("dry run: first message received", "stream", streamType, "slot", slot, "after", time.Since(start).Round(time.Millisecond))
+		case status.Code(err) == codes.DeadlineExceeded && ctx.Err() == nil:
+			log.Info("dry run: subscription accepted, no message yet", "stream", streamType, "waited", timeout)
+		default:
+			log.Error("dry run failed", "stream", streamType, "code", status.Code(err), "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", streamType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// probe opens one subscription and returns the slot of its first message.
+func probe(ctx context.Context, client proto.CoreCastClient, cfg *internal.Config, streamType string, timeout time.Duration) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch streamType {
+	case "dex_trades":
+		strm, err := client.DexTrades(ctx, tradesRequest(cfg))
+		if err != nil {
+			return 0, err
+		}
+		v, _, err := recvTrade(strm)
+		return v.Slot, err
+	case "dex_orders":
+		strm, err := client.DexOrders(ctx, ordersRequest(cfg))
+		if err != nil {
+			return 0, err
+		}
+		v, _, err := recvOrder(strm)
+		return v.Slot, err
+	case "dex_pools":
+		strm, err := client.DexPools(ctx, poolsRequest(cfg))
+		if err != nil {
+			return 0, err
+		}
+		v, _, err := recvPoolEvent(strm)
+		return v.Slot, err
+	case "transactions":
+		strm, err := client.Transactions(ctx, transactionsRequest(cfg))
+		if err != nil {
+			return 0, err
+		}
+		v, _, err := recvTransaction(strm)
+		return v.Slot, err
+	case "transfers":
+		strm, err := client.Transfers(ctx, transfersRequest(cfg))
+		if err != nil {
+			return 0, err
+		}
+		v, _, err := recvTransfer(strm)
+		return v.Slot, err
+	case "balances":
+		strm, err := client.Balances(ctx, balancesRequest(cfg))
+		if err != nil {
+			return 0, err
+		}
+		v, _, err := recvBalance(strm)
+		return v.Slot, err
+	}
+	return 0, fmt.Errorf("unknown stream type %q", streamType)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// enumTracker labels proto enum values and counts the ones our compiled
+// protos don't know about, so a server-side enum addition shows up as
+// "unknown(<n>)" instead of a blank or misleading name.
+type enumTracker struct {
+	mu      sync.Mutex
+	unknown map[string]int // "<enum full name>(<n>)" -> occurrences
+}
+
+func newEnumTracker() *enumTracker {
+	return &enumTracker{unknown: make(map[string]int)}
+}
+
+func (t *enumTracker) label(e protoreflect.Enum) string {
+	num := e.Number()
+	desc := e.Descriptor()
+	if v := desc.Values().ByNumber(num); v != nil {
+		return string(v.Name())
+	}
+
+	key := fmt.Sprintf("%s(%d)", desc.FullName(), num)
+	t.mu.Lock()
+	t.unknown[key]++
+	first := t.unknown[key] == 1
+	t.mu.Unlock()
+	if first {
+		log.Warn("unknown enum value, protos may be outdated", "enum", desc.FullName(), "value", num)
+	}
+	return fmt.Sprintf("unknown(%d)", num)
+}
+
+// report logs how often each unknown enum value was seen during the run.
+func (t *enumTracker) report() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, n := range t.unknown {
+		log.Warn("unknown enum values seen", "value", key, "count", n)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+var errChildExited = errors.New("output.exec command exited")
+
+// execWriter pipes output lines into the stdin of a command started once at
+// startup. Lines are queued in a bounded buffer; when it is full Write blocks,
+// which slows the stream down instead of dropping records. If the command
+// exits, onExit is called so the client stops rather than losing data.
+type execWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+	done  chan struct{} // closed when the command has exited
+	drain chan struct{} // closed when the pump has finished writing
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newExecWriter(argv []string, buffer int, onExit func()) (*execWriter, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("output.exec.command is empty")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdout = os.Stderr // keep our stdout free, the child's output goes to the log stream
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	log.Info("exec output started", "command", argv[0], "pid", cmd.Process.Pid)
+
+	w := &execWriter{
+		cmd:   cmd,
+		stdin: stdin,
+		lines: make(chan []byte, buffer),
+		done:  make(chan struct{}),
+		drain: make(chan struct{}),
+	}
+	go w.pump()
+	go func() {
+		err := cmd.Wait()
+		close(w.done)
+		w.mu.Lock()
+		expected := w.closed
+		w.mu.Unlock()
+		if !expected {
+			log.Error("exec output command exited, stopping", "command", argv[0], "err", err)
+			onExit()
+		}
+	}()
+	return w, nil
+}
+
+func (w *execWriter) pump() {
+	defer close(w.drain)
+	for line := range w.lines {
+		if _, err := w.stdin.Write(line); err != nil {
+			log.Error("exec output write", "err", err)
+			for range w.lines {
+				// discard, the command is gone
+			}
+			return
+		}
+	}
+}
+
+func (w *execWriter) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errChildExited
+	}
+	select {
+	case w.lines <- line:
+		return len(p), nil
+	case <-w.done:
+		return 0, errChildExited
+	}
+}
+
+// pending returns the number of lines queued but not yet written.
+func (w *execWriter) pending() int {
+	return len(w.lines)
+}
+
+// Close flushes the buffered lines, closes the command's stdin and waits for
+// it to exit, killing it if it doesn't within a few seconds.
+func (w *execWriter) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	close(w.lines)
+	w.mu.Unlock()
+
+	<-w.drain
+	w.stdin.Close()
+	select {
+	case <-w.done:
+	case <-time.After(5 * time.Second):
+		log.Warn("exec output command did not exit, killing it")
+		w.cmd.Process.Kill()
+		<-w.done
+	}
+	return nil
+}
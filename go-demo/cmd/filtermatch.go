@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+
+	"corecast-client-example/internal"
+)
+
+// streamFilters lists the filters each stream type sends in its subscribe
+// request, in the order they are reported.
+var streamFilters = map[string][]string{
+	"dex_trades":   {"programs", "pools", "tokens", "traders"},
+	"dex_orders":   {"programs", "pools", "tokens", "traders"},
+	"dex_pools":    {"programs", "pools", "tokens"},
+	"transactions": {"programs", "signers"},
+	"transfers":    {"senders", "receivers", "tokens"},
+	"balances":     {"addresses", "tokens"},
+}
+
+type filterValue struct {
+	address string
+	raw     []byte
+	count   uint64
+}
+
+// filterMatches counts, for every configured filter value, the messages
+// that contain it, so values that never produce data stand out.
+type filterMatches struct {
+	mu      sync.Mutex
+	order   []string
+	filters map[string][]*filterValue
+}
+
+func newFilterMatches(streamTypes []string, cfg *internal.Config) *filterMatches {
+	configured := map[string][]string{
+		"programs":  cfg.Filters.Programs,
+		"pools":     cfg.Filters.Pools,
+		"tokens":    cfg.Filters.Tokens,
+		"traders":   cfg.Filters.Traders,
+		"senders":   cfg.Filters.Senders,
+		"receivers": cfg.Filters.Receivers,
+		"addresses": cfg.Filters.Addresses,
+		"signers":   cfg.Filters.Signers,
+	}
+
+	m := &filterMatches{filters: make(map[string][]*filterValue)}
+	var names []string
+	for _, streamType := range streamTypes {
+		for _, name := range streamFilters[streamType] {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, name := range names {
+		for _, addr := range configured[name] {
+			raw, err := base58.Decode(addr)
+			if err != nil {
+				log.Warn("filter value is not base58, not counting matches", "filter", name, "value", addr)
+				continue
+			}
+			m.filters[name] = append(m.filters[name], &filterValue{address: addr, raw: raw})
+		}
+		if len(m.filters[name]) > 0 {
+			m.order = append(m.order, name)
+		}
+	}
+	return m
+}
+
+// match counts one message for each value of the named filter that equals
+// one of the addresses taken from the message.
+func (m *filterMatches) match(name string, addresses ...[]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.filters[name] {
+		for _, addr := range addresses {
+			if bytes.Equal(v.raw, addr) {
+				v.count++
+				break
+			}
+		}
+	}
+}
+
+// report logs the match count of every filter value; values that never
+// matched are logged as warnings.
+func (m *filterMatches) report() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range m.order {
+		for _, v := range m.filters[name] {
+			if v.count == 0 {
+				log.Warn("filter value never matched", "filter", name, "value", v.address)
+				continue
+			}
+			log.Info("filter matches", "filter", name, "value", v.address, "messages", v.count)
+		}
+	}
+}
+
+// writeMetrics writes the match counts as the corecast_filter_matches_total
+// series, one per filter value.
+func (m *filterMatches) writeMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP corecast_filter_matches_total Messages that contained each configured filter value.\n# TYPE corecast_filter_matches_total counter\n")
+	for _, name := range m.order {
+		for _, v := range m.filters[name] {
+			fmt.Fprintf(w, "corecast_filter_matches_total{filter=%q,value=%q} %d\n", name, v.address, v.count)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// healthCheck serves the probes of health.listen: /healthz answers as long
+// as the process runs, /readyz only while every stream type that isn't
+// paused has received a message within maxStaleness, which also catches
+// silent stalls. /pause and /resume pause and resume one stream type, or
+// all of them.
+type healthCheck struct {
+	ctx          context.Context // canceled on shutdown
+	stats        *stats
+	pause        *pauser
+	streams      []string
+	maxStaleness time.Duration
+}
+
+func (h *healthCheck) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		ready, report := h.ready()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, report)
+	})
+	mux.HandleFunc("POST /pause", h.setPaused(true))
+	mux.HandleFunc("POST /resume", h.setPaused(false))
+}
+
+// setPaused handles /pause and /resume, for the stream type named by the
+// stream query parameter or for all of them when it is empty.
+func (h *healthCheck) setPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		streams := h.streams
+		if stream := r.URL.Query().Get("stream"); stream != "" {
+			if !slices.Contains(h.streams, stream) {
+				http.Error(w, fmt.Sprintf("stream %q is not subscribed", stream), http.StatusBadRequest)
+				return
+			}
+			streams = []string{stream}
+		}
+		h.pause.set(paused, streams...)
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// ready reports whether every stream that isn't paused is fresh, with one
+// line per stream.
+func (h *healthCheck) ready() (bool, string) {
+	if h.ctx.Err() != nil {
+		return false, "shutting down\n"
+	}
+	snap := h.stats.snapshot()
+	ready := true
+	var b strings.Builder
+	for _, stream := range h.streams {
+		last := snap.Streams[stream].LastMessage
+		since, running := h.pause.idleSince(stream, last)
+		switch age := time.Since(since).Round(time.Millisecond); {
+		case !running:
+			fmt.Fprintf(&b, "%s: paused\n", stream)
+		case last.IsZero():
+			ready = false
+			fmt.Fprintf(&b, "%s: no message yet\n", stream)
+		case age > h.maxStaleness:
+			ready = false
+			fmt.Fprintf(&b, "%s: stale, last message %s ago (max %s)\n", stream, age, h.maxStaleness)
+		default:
+			fmt.Fprintf(&b, "%s: ok, last message %s ago\n", stream, age)
+		}
+	}
+	return ready, b.String()
+}
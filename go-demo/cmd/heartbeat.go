@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+type heartbeat struct {
+	Stream   string    `output:"Stream"`
+	Time     time.Time `output:"Time"`
+	LastSlot uint64    `output:"LastSlot"`
+}
+
+// runHeartbeat emits a Heartbeat record through the configured output
+// whenever no message arrived on stream during the last interval, so
+// downstream readers can tell a quiet stream from a dead client. Nothing is
+// emitted while the stream is paused.
+func (c *consumer) runHeartbeat(ctx context.Context, stream string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			st := c.stats.snapshot().Streams[stream]
+			since, running := c.pause.idleSince(stream, st.LastMessage)
+			if !running || now.Sub(since) < interval {
+				continue
+			}
+			c.emitRecord(stream, "Heartbeat", heartbeat{Stream: stream, Time: now.UTC(), LastSlot: st.LastSlot})
+		}
+	}
+}
+
+// runStatsLine logs a summary line per stream every interval, whether or
+// not messages arrived, so a quiet market (messages trickling in, small
+// idle time) can be told from a dead connection (no new messages, idle
+// time growing).
+func (c *consumer) runStatsLine(ctx context.Context, streams []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prev := c.stats.snapshot()
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			snap := c.stats.snapshot()
+			for _, stream := range streams {
+				st := snap.Streams[stream]
+				last := st.LastMessage
+				if last.IsZero() {
+					last = start
+				}
+				ctx := []any{
+					"Stream", stream,
+					"Messages", st.Messages,
+					"SinceLast", st.Messages - prev.Streams[stream].Messages,
+					"IdleSeconds", int(now.Sub(last).Seconds()),
+					"LastSlot", st.LastSlot,
+				}
+				if st.Latency.Count > 0 {
+					ctx = append(ctx, "LatencySeconds", st.Latency.Last.Seconds())
+				}
+				log.Info("Stats", ctx...)
+			}
+			prev = snap
+		}
+	}
+}
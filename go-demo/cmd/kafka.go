@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"corecast-client-example/internal"
+)
+
+// kafkaSink produces every consumed message to a Kafka topic as canonical
+// proto JSON, the same encoding as output.format: protojson, in addition to
+// the regular output. Messages are batched and sent in the background;
+// failed batches are retried by the writer and then logged and counted.
+type kafkaSink struct {
+	w      *kafka.Writer
+	key    recordKey // output.kafka.key_field
+	opts   protojson.MarshalOptions
+	rename map[string]string // output.rename, applied to the encoded keys
+	stats  *stats
+	redact *redactor   // set when output.redact.fields is configured
+	spill  *kafkaSpill // set when output.kafka.spill_file is configured
+
+	queued atomic.Uint64 // messages handed to the writer
+}
+
+func newKafkaSink(cfg *internal.Config, s *stats) (*kafkaSink, error) {
+	kc := cfg.Output.Kafka
+	if kc.Topic == "" {
+		return nil, fmt.Errorf("output.kafka.topic is required")
+	}
+	key, err := newRecordKey("output.kafka.key_field", kc.KeyField, cfg.StreamTypes())
+	if err != nil {
+		return nil, err
+	}
+	k := &kafkaSink{key: key, opts: protojson.MarshalOptions{UseProtoNames: true}, rename: cfg.Output.Rename, stats: s}
+	k.w = &kafka.Writer{
+		Addr:         kafka.TCP(kc.Brokers...),
+		Topic:        kc.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  kc.MaxAttempts,
+		BatchTimeout: 50 * time.Millisecond,
+		Async:        true,
+		Completion:   k.completed,
+	}
+	if kc.SpillFile != "" {
+		spill, unconfirmed, err := newKafkaSpill(kc.SpillFile)
+		if err != nil {
+			return nil, fmt.Errorf("output.kafka.spill_file: %w", err)
+		}
+		k.spill = spill
+		if len(unconfirmed) > 0 {
+			log.Warn("kafka spill: producing the messages left unacknowledged by the last run", "path", kc.SpillFile, "messages", len(unconfirmed))
+			if err := k.w.WriteMessages(context.Background(), unconfirmed...); err != nil {
+				return nil, fmt.Errorf("kafka produce: %w", err)
+			}
+			k.queued.Add(uint64(len(unconfirmed)))
+		}
+	}
+	return k, nil
+}
+
+// handle queues the message of rec for the topic; the client's own records
+// have none and are not published. It doesn't block on the brokers. It
+// runs before the output.format sink, which may prune or redact the
+// message in place, so it redacts a copy of its own.
+func (k *kafkaSink) handle(_ string, rec record) error {
+	msg := rec.msg
+	if msg == nil {
+		return nil
+	}
+	if k.redact != nil {
+		msg = protobuf.Clone(msg)
+		k.redact.message(msg.ProtoReflect())
+	}
+	b, err := k.opts.Marshal(msg)
+	if err == nil {
+		b, err = renameJSON(b, k.rename)
+	}
+	b = withRecordHash(b, rec.hash)
+	if err != nil {
+		return fmt.Errorf("kafka encode: %w", err)
+	}
+	m := kafka.Message{Key: k.key.of(msg.ProtoReflect()), Value: b}
+	spillErr := k.spill.add(&m)
+	err = k.w.WriteMessages(context.Background(), m)
+	if err != nil {
+		k.stats.kafkaResult(0, 1)
+		return fmt.Errorf("kafka produce: %w", err)
+	}
+	k.queued.Add(1)
+	if spillErr != nil {
+		return fmt.Errorf("kafka spill: %w", spillErr)
+	}
+	return nil
+}
+
+// pending returns the number of messages not yet acknowledged or failed.
+func (k *kafkaSink) pending() int {
+	snap := k.stats.snapshot()
+	return int(k.queued.Load() - snap.KafkaSent - snap.KafkaFailed)
+}
+
+func (k *kafkaSink) completed(messages []kafka.Message, err error) {
+	if err != nil {
+		log.Error("kafka produce failed after retries", "topic", k.w.Topic, "messages", len(messages), "err", err)
+		k.stats.kafkaResult(0, uint64(len(messages)))
+		return
+	}
+	k.spill.acknowledged(messages)
+	k.stats.kafkaResult(uint64(len(messages)), 0)
+}
+
+// Close flushes the queued messages, then the spill file.
+func (k *kafkaSink) Close() error {
+	err := k.w.Close()
+	if serr := k.spill.close(); err == nil {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/segmentio/kafka-go"
+)
+
+// spillEntry is one line of the spill file.
+type spillEntry struct {
+	Seq   uint64          `json:"seq"`
+	Key   []byte          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaSpill keeps the Kafka messages handed to the writer but not yet
+// acknowledged in a local file (output.kafka.spill_file), so a client that
+// crashes or is killed produces them again on its next start: delivery is
+// at least once. Every message is appended to the file before it is
+// produced; acknowledged messages are only dropped from it when the file is
+// rewritten, every stream.checkpoint.interval and on shutdown. A nil spill
+// keeps nothing.
+type kafkaSpill struct {
+	path string
+
+	mu      sync.Mutex
+	f       *os.File
+	next    uint64                   // sequence number of the next message
+	pending map[uint64]kafka.Message // written to the file, not acknowledged
+}
+
+// newKafkaSpill opens the spill file at path and returns the messages left
+// unacknowledged by the previous run, which the caller produces again. A
+// line cut short by a crash mid-write is skipped.
+func newKafkaSpill(path string) (*kafkaSpill, []kafka.Message, error) {
+	s := &kafkaSpill{path: path, pending: make(map[uint64]kafka.Message)}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	var unconfirmed []kafka.Message
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var e spillEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			log.Warn("kafka spill: skipping a damaged line", "path", path, "err", err)
+			continue
+		}
+		m := kafka.Message{Key: e.Key, Value: e.Value, WriterData: s.next}
+		s.pending[s.next] = m
+		s.next++
+		unconfirmed = append(unconfirmed, m)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	// Renumbered and still in the file until they are acknowledged again.
+	if err := s.compact(); err != nil {
+		return nil, nil, err
+	}
+	return s, unconfirmed, nil
+}
+
+// add numbers m and appends it to the file before it is produced.
+func (s *kafkaSpill) add(m *kafka.Message) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.WriterData = s.next
+	s.pending[s.next] = *m
+	s.next++
+	line, err := json.Marshal(spillEntry{Seq: m.WriterData.(uint64), Key: m.Key, Value: m.Value})
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+// acknowledged forgets messages Kafka has acknowledged. Messages that failed
+// after retries stay, to be produced again on the next start.
+func (s *kafkaSpill) acknowledged(messages []kafka.Message) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range messages {
+		if seq, ok := m.WriterData.(uint64); ok {
+			delete(s.pending, seq)
+		}
+	}
+}
+
+// run rewrites the file every interval until ctx is cancelled.
+func (s *kafkaSpill) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.compact(); err != nil {
+				log.Error("kafka spill", "path", s.path, "err", err)
+			}
+		}
+	}
+}
+
+// compact replaces the file with the messages still pending, atomically so
+// a crash mid-write can't lose them, and reopens it for appending.
+func (s *kafkaSpill) compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seqs := make([]uint64, 0, len(s.pending))
+	for seq := range s.pending {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, seq := range seqs {
+		m := s.pending[seq]
+		if err = enc.Encode(spillEntry{Seq: seq, Key: m.Key, Value: m.Value}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if s.f != nil {
+		s.f.Close()
+	}
+	// tmp stays open for appending: after the rename it is the spill file.
+	s.f = tmp
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// close rewrites the file a last time, once the writer has flushed, and
+// closes it. What is left in it is produced again on the next start.
+func (s *kafkaSpill) close() error {
+	if s == nil {
+		return nil
+	}
+	err := s.compact()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if left := len(s.pending); left > 0 {
+		log.Warn("kafka spill: messages left unacknowledged, produced again on the next start", "path", s.path, "messages", left)
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaSpill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kafka.spill")
+	s, unconfirmed, err := newKafkaSpill(path)
+	if err != nil || len(unconfirmed) != 0 {
+		t.Fatalf("new spill: %d messages, %v", len(unconfirmed), err)
+	}
+	var msgs []kafka.Message
+	for _, v := range []string{`{"a":1}`, `{"a":2}`, `{"a":3}`} {
+		m := kafka.Message{Key: []byte("k"), Value: []byte(v)}
+		if err := s.add(&m); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+	s.acknowledged(msgs[:1])
+
+	// A crash before the file is rewritten produces the acknowledged
+	// message again too: that is the duplicate window.
+	_, unconfirmed, err = newKafkaSpill(path)
+	if err != nil || len(unconfirmed) != 3 {
+		t.Fatalf("after a crash: %d messages, %v, want 3", len(unconfirmed), err)
+	}
+
+	s, _, _ = newKafkaSpill(path)
+	s.acknowledged([]kafka.Message{{WriterData: uint64(0)}})
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+	// A line cut short by a crash mid-write is skipped.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"seq":9,"value":{"a"`)
+	f.Close()
+	_, unconfirmed, err = newKafkaSpill(path)
+	if err != nil || len(unconfirmed) != 2 {
+		t.Fatalf("after close: %d messages, %v, want 2", len(unconfirmed), err)
+	}
+	if string(unconfirmed[0].Value) != `{"a":2}` || string(unconfirmed[0].Key) != "k" {
+		t.Errorf("first message = %s %s, want k {\"a\":2}", unconfirmed[0].Key, unconfirmed[0].Value)
+	}
+}
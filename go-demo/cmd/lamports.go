@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const lamportsPerSOL = 1_000_000_000
+
+type nativeBalanceUpdate interface {
+	GetPreBalance() uint64
+	GetPostBalance() uint64
+}
+
+// transactionLamports estimates the SOL value of a transaction as its fee plus
+// the lamports credited to accounts in the native balance updates (the
+// debits mirror the credits plus the fee, so they are not counted again).
+// known is false when the message carries no balance updates.
+func transactionLamports[B nativeBalanceUpdate](fee uint64, updates []B) (value uint64, known bool) {
+	for _, u := range updates {
+		if u.GetPostBalance() > u.GetPreBalance() {
+			value += u.GetPostBalance() - u.GetPreBalance()
+		}
+	}
+	return value + fee, len(updates) > 0
+}
+
+func solToLamports(sol float64) uint64 {
+	if sol <= 0 {
+		return 0
+	}
+	return uint64(math.Round(sol * lamportsPerSOL))
+}
+
+// formatLamports renders lamports as an exact SOL decimal string.
+func formatLamports(lamports uint64) string {
+	s := fmt.Sprintf("%d.%09d", lamports/lamportsPerSOL, lamports%lamportsPerSOL)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram.
+var latencyBuckets = [...]float64{0.5, 1, 2, 5, 10, 30, 60}
+
+// latencyHistogram counts delivery latencies per bucket of latencyBuckets,
+// the last count being +Inf. It is a plain value so stats snapshots can
+// copy it.
+type latencyHistogram struct {
+	Counts [len(latencyBuckets) + 1]uint64
+	Sum    float64
+	Count  uint64
+	Last   time.Duration // latest sample
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Sum += d.Seconds()
+	h.Count++
+	h.Last = d
+}
+
+// write emits h in the Prometheus histogram format, with cumulative buckets.
+func (h *latencyHistogram) write(w io.Writer, name, stream string) {
+	var cum uint64
+	for i, le := range latencyBuckets {
+		cum += h.Counts[i]
+		fmt.Fprintf(w, "%s_bucket{stream=%q,le=\"%g\"} %d\n", name, stream, le, cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{stream=%q,le=\"+Inf\"} %d\n", name, stream, h.Count)
+	fmt.Fprintf(w, "%s_sum{stream=%q} %g\n%s_count{stream=%q} %d\n", name, stream, h.Sum, name, stream, h.Count)
+}
+
+// latencyProbe samples the delivery latency of a stream: how long after its
+// block time the first message of a slot was received. The messages carry
+// no timestamp, so once per interval the block time of the latest slot is
+// fetched over JSON-RPC (getBlockTime). Solana block times have a one
+// second resolution, and a slot's time is only available once the block is
+// confirmed, so a sample is retried for up to a minute.
+type latencyProbe struct {
+	url      string
+	client   *http.Client
+	stats    *stats
+	stream   string
+	interval time.Duration
+}
+
+func newLatencyProbe(url string, timeout time.Duration, s *stats, stream string, interval time.Duration) *latencyProbe {
+	return &latencyProbe{url: url, client: &http.Client{Timeout: timeout}, stats: s, stream: stream, interval: interval}
+}
+
+func (p *latencyProbe) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	var slot uint64 // waiting for its block time, 0 for none
+	var sampled uint64
+	var received time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if slot == 0 {
+			st := p.stats.snapshot().Streams[p.stream]
+			if st.LastSlot == sampled {
+				continue // no new slot since the last sample
+			}
+			slot, received = st.LastSlot, st.LastSlotAt
+		}
+		blockTime, err := p.blockTime(ctx, slot)
+		if err != nil {
+			log.Debug("block time lookup failed", "stream", p.stream, "slot", slot, "err", err)
+			if time.Since(received) > time.Minute {
+				sampled, slot = slot, 0
+			}
+			continue
+		}
+		latency := received.Sub(time.Unix(blockTime, 0))
+		p.stats.latency(p.stream, latency)
+		log.Debug("latency sample", "stream", p.stream, "slot", slot, "latency", latency)
+		sampled, slot = slot, 0
+	}
+}
+
+// blockTime returns the estimated production time of slot as a Unix time.
+func (p *latencyProbe) blockTime(ctx context.Context, slot uint64) (int64, error) {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "getBlockTime",
+		"params":  []any{slot},
+	})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("rpc status %s", resp.Status)
+	}
+
+	var out struct {
+		Result *int64 `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	if out.Error != nil {
+		return 0, fmt.Errorf("rpc error: %s", out.Error.Message)
+	}
+	if out.Result == nil {
+		return 0, fmt.Errorf("no block time for slot %d", slot)
+	}
+	return *out.Result, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mattn/go-isatty"
+
+	"corecast-client-example/internal"
+)
+
+// logLevel is logging.level, applied to every handler installed on the root
+// logger so records below it are dropped whatever the destination.
+var logLevel = log.LvlInfo
+
+// logFormat is logging.format: terminal, json or logfmt. Empty picks
+// terminal for a terminal and logfmt otherwise, like log15 does.
+var logFormat string
+
+// setupLogging replaces log15's default stdout handler with one using the
+// configured level and format. Unknown values keep the defaults here and
+// are reported by Config.Validate.
+func setupLogging(cfg *internal.Config) {
+	if lvl, err := log.LvlFromString(cfg.Logging.Level); err == nil {
+		logLevel = lvl
+	}
+	logFormat = cfg.Logging.Format
+	log.Root().SetHandler(logHandler(os.Stdout))
+}
+
+// logHandler writes records at logging.level and above to w in
+// logging.format. Anything but stdout, batched or not, i.e. output.file,
+// gets logfmt instead of the colored terminal format.
+func logHandler(w io.Writer) log.Handler {
+	var format log.Format
+	switch {
+	case logFormat == "json":
+		format = log.JsonFormat()
+	case logFormat == "logfmt", !isStdout(w):
+		format = log.LogfmtFormat()
+	case logFormat == "terminal", isatty.IsTerminal(os.Stdout.Fd()):
+		format = log.TerminalFormat()
+	default:
+		format = log.LogfmtFormat()
+	}
+	return levelFilter(log.StreamHandler(w, format))
+}
+
+// isStdout reports whether w is stdout or an output.batch_size batch of it.
+func isStdout(w io.Writer) bool {
+	if b, ok := w.(*batchWriter); ok {
+		w = b.out
+	}
+	return w == os.Stdout
+}
+
+// levelFilter drops records below logging.level before they reach h.
+func levelFilter(h log.Handler) log.Handler {
+	return log.LvlFilterHandler(logLevel, h)
+}
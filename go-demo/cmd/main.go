@@ -3,15 +3,26 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
-	solana_messages "github.com/bitquery/streaming_protobuf/v2/solana/messages"
 	log "github.com/inconshreveable/log15"
+	"github.com/mattn/go-isatty"
 	_ "github.com/mostynb/go-grpc-compression/zstd" // zstd codec registration
 	"github.com/mr-tron/base58"
 	"google.golang.org/grpc"
@@ -20,19 +31,61 @@ import (
 	_ "google.golang.org/grpc/encoding/gzip" // gzip codec registration
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
+	protobuf "google.golang.org/protobuf/proto"
+	"gopkg.in/natefinch/lumberjack.v2"
 
 	"corecast-client-example/internal"
+	"corecast-client-example/internal/amount"
+	"corecast-client-example/internal/encode"
 )
 
 func main() {
 	configPath := flag.String("config", "./configs/config.yaml", "Path to configuration file")
+	tui := flag.Bool("tui", false, "Show a live dashboard instead of logging every message (requires a terminal)")
+	dryRunFlag := flag.Bool("dry-run", false, "Check config, connection, auth and subscription, wait for the first message, then exit")
+	dryRunTimeout := flag.Duration("dry-run-timeout", 15*time.Second, "How long -dry-run waits for the first message of each stream")
+	versionFlag := flag.Bool("version", false, "Print the version, commit and build date, then exit")
+	replayPath := flag.String("replay", "", "Feed the messages of an output.raw_dump file to the configured stream types instead of connecting, then exit")
+	printConfig := flag.Bool("print-config", false, "Print the effective config (file, environment and defaults) as YAML with secrets redacted, then exit")
 	flag.Parse()
 
+	ver, rev, date := buildInfo()
+	if *versionFlag {
+		fmt.Printf("corecast-client-example %s (commit %s, built %s, %s)\n", ver, rev, date, runtime.Version())
+		return
+	}
+
+	// Set when a stream gave up; the exit status is changed only after the
+	// deferred cleanup below has run.
+	var failed atomic.Bool
+	defer func() {
+		if failed.Load() {
+			os.Exit(1)
+		}
+	}()
+
 	config, err := internal.LoadConfig(*configPath)
 	if err != nil {
 		log.Error("Failed to load config", "path", *configPath, "err", err)
 		os.Exit(1)
 	}
+	if *printConfig {
+		if err := printEffectiveConfig(os.Stdout, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	setupLogging(config)
+	log.Info("corecast-client-example", "version", ver, "commit", rev, "built", date)
+	if err := config.Validate(); err != nil {
+		log.Error("invalid config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+	if unused := config.UnusedFilters(); len(unused) > 0 {
+		log.Warn("filters ignored by the configured stream types", "streams", strings.Join(config.StreamTypes(), ","), "filters", strings.Join(unused, ","))
+	}
+	streamTypes := config.StreamTypes()
 
 	// Debug loaded configuration (without leaking secrets)
 	log.Debug(
@@ -41,7 +94,10 @@ func main() {
 		"server.address", config.Server.Address,
 		"server.insecure", config.Server.Insecure,
 		"server.has_auth", config.Server.Authorization != "",
-		"stream.type", config.Stream.Type,
+		"server.token_provider", config.Server.TokenProvider.Type,
+		"server.compression", config.Server.Compression,
+		"stream.types", strings.Join(streamTypes, ","),
+		"tuning.max_recv_msg_size", config.Tuning.MaxRecvMsgSize,
 		"filters.programs", len(config.Filters.Programs),
 		"filters.pools", len(config.Filters.Pools),
 		"filters.tokens", len(config.Filters.Tokens),
@@ -52,325 +108,1190 @@ func main() {
 		"filters.signers", len(config.Filters.Signers),
 	)
 
-	conn, ctx, err := NewConnection(config)
-	if err != nil {
-		log.Error("dial failed", "err", err)
-		os.Exit(1)
+	var dialOpts []grpc.DialOption
+	if path := config.Output.RawDump; path != "" && *replayPath == "" {
+		codec, err := newRawDumpCodec(path)
+		if err != nil {
+			log.Error("raw dump", "path", path, "err", err)
+			os.Exit(1)
+		}
+		defer codec.Close()
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.ForceCodecV2(codec)))
+		log.Info("dumping raw messages", "path", path)
 	}
 
-	streamCtx, cancel := signalContext(ctx)
+	// Installed before dialing, so Ctrl+C also stops fetching the token.
+	streamCtx, cancel := signalContext(context.Background(), config.Shutdown.GracePeriod)
+	// A replay reads a dump instead of the server; nothing is dialed.
+	var conn *grpc.ClientConn
 	defer func() {
-		conn.Close()
+		if conn != nil {
+			conn.Close()
+		}
 		cancel()
 	}()
+	if *replayPath == "" {
+		conn, streamCtx, err = NewConnection(streamCtx, config, dialOpts...)
+		if err != nil {
+			log.Error("dial failed", "err", err)
+			os.Exit(1)
+		}
+	}
 
 	client := proto.NewCoreCastClient(conn)
 
-	switch config.Stream.Type {
-	case "dex_trades":
-		req := &proto.SubscribeTradesRequest{
-			Program: addrFilterFromSlice(config.Filters.Programs),
-			Pool:    addrFilterFromSlice(config.Filters.Pools),
-			Token:   addrFilterFromSlice(config.Filters.Tokens),
-			Trader:  addrFilterFromSlice(config.Filters.Traders),
+	if *dryRunFlag && *replayPath == "" {
+		if err := dryRun(streamCtx, client, config, *dryRunTimeout); err != nil {
+			conn.Close()
+			os.Exit(1)
 		}
-		log.Info("trades subscribe", "req", req)
-		strm, err := client.DexTrades(streamCtx, req)
+		log.Info("dry run passed")
+		return
+	}
+
+	c := &consumer{
+		cfg:     config,
+		enums:   newEnumTracker(),
+		stats:   newStats(),
+		matches: newFilterMatches(streamTypes, config),
+		pause:   newPauser(),
+		limit:   newByteLimiter(config.Stream.MaxBytesPerSec),
+		quota:   newMessageQuota(config.Stream.MaxMessages, cancel),
+	}
+	c.dedup = newDedupFilter(config.Dedup.WindowSize, config.Dedup.Key, c.stats)
+	if d := config.Stream.MaxDuration; d > 0 {
+		t := time.AfterFunc(d, func() {
+			log.Info("stream.max_duration reached, stopping", "duration", d)
+			cancel()
+		})
+		defer t.Stop()
+	}
+	watchPauseSignals(streamCtx, c.pause, streamTypes)
+	if tp := config.Server.TokenProvider; tp.Type != "" && tp.RefreshInterval > 0 && *replayPath == "" {
+		c.refresher, err = newTokenRefresher(config)
 		if err != nil {
-			log.Error("trades subscribe", "err", err)
+			log.Error("token provider", "err", err)
 			os.Exit(1)
 		}
-		consumeDexTrades(strm)
-	case "dex_orders":
-		req := &proto.SubscribeOrdersRequest{
-			Program: addrFilterFromSlice(config.Filters.Programs),
-			Pool:    addrFilterFromSlice(config.Filters.Pools),
-			Token:   addrFilterFromSlice(config.Filters.Tokens),
-			Trader:  addrFilterFromSlice(config.Filters.Traders),
+		go c.refresher.run(streamCtx, tp.RefreshInterval)
+	}
+	// Runs after the sinks' deferred Close calls, which flush their queues.
+	var pending int // output queued in the sinks when the streams stopped
+	var kafkaFailed uint64
+	defer func() {
+		if pending > 0 {
+			failed := c.stats.snapshot().KafkaFailed - kafkaFailed
+			log.Info("output drained", "flushed", pending-int(failed), "failed", failed)
 		}
-		log.Info("orders subscribe", "req", req)
-		strm, err := client.DexOrders(streamCtx, req)
+	}()
+	switch config.Stream.Mode {
+	case "", "events":
+	case "distinct_tokens":
+		if slices.Contains(streamTypes, "transactions") {
+			log.Error("distinct_tokens mode is not supported for transactions stream")
+			os.Exit(1)
+		}
+		c.tokens, err = newTokenTracker(config.Stream.SeenTokensFile)
 		if err != nil {
-			log.Error("orders subscribe", "err", err)
+			log.Error("seen tokens load", "path", config.Stream.SeenTokensFile, "err", err)
 			os.Exit(1)
 		}
-		consumeDexOrders(strm)
-	case "dex_pools":
-		req := &proto.SubscribePoolsRequest{
-			Program: addrFilterFromSlice(config.Filters.Programs),
-			Pool:    addrFilterFromSlice(config.Filters.Pools),
-			Token:   addrFilterFromSlice(config.Filters.Tokens),
+		defer c.tokens.Close()
+	case "first_trades":
+		if !slices.Equal(streamTypes, []string{"dex_trades"}) {
+			log.Error("first_trades mode is only supported for dex_trades stream")
+			os.Exit(1)
 		}
-		log.Info("pools subscribe", "req", req)
-		strm, err := client.DexPools(streamCtx, req)
+		c.firstTrades, err = newTokenTracker(config.Stream.SeenTokensFile)
 		if err != nil {
-			log.Error("pools subscribe", "err", err)
+			log.Error("seen tokens load", "path", config.Stream.SeenTokensFile, "err", err)
 			os.Exit(1)
 		}
-		consumeDexPools(strm)
-	case "transactions":
-		req := &proto.SubscribeTransactionsRequest{
-			Program: addrFilterFromSlice(config.Filters.Programs),
-			Signer:  addrFilterFromSlice(config.Filters.Signers),
+		defer c.firstTrades.Close()
+	default:
+		log.Error("unknown stream mode", "mode", config.Stream.Mode, "supported", "events|distinct_tokens|first_trades")
+		os.Exit(1)
+	}
+
+	switch config.Filters.TransferKind {
+	case "", transferNative, transferSPL:
+	default:
+		log.Error("unknown transfer kind", "transfer_kind", config.Filters.TransferKind, "supported", "native|spl")
+		os.Exit(1)
+	}
+
+	c.orderStates, err = orderStates(config.Filters.OrderStates)
+	if err != nil {
+		log.Error("order states filter", "err", err)
+		os.Exit(1)
+	}
+
+	c.minAmount = newMinAmountFilter(config.Filters.MinAmount)
+	c.mints = newMintFilter(config.Filters.IncludeMints, config.Filters.ExcludeMints)
+
+	if wt := config.Analyzers.WashTrading; wt.Enabled {
+		c.wash = newWashDetector(wt.Window, wt.MinRoundTrips, wt.MaxTracked)
+	}
+	if pc := config.Analyzers.PriceChange; pc.Enabled {
+		c.prices = newPriceChangeDetector(pc.ThresholdPct, pc.Window, pc.MinTrades, pc.MaxTracked)
+		if pc.Webhook != "" {
+			c.priceWebhook = newWebhookQueue("price_change", pc.Webhook)
+			go c.priceWebhook.run(streamCtx)
 		}
-		log.Info("transactions subscribe", "req", req)
-		strm, err := client.Transactions(streamCtx, req)
+	}
+
+	if config.RPC.URL != "" {
+		c.owners = newOwnerResolver(config.RPC.URL, config.RPC.Timeout)
+		go c.owners.run(streamCtx)
+	}
+
+	destinations := 0
+	for _, set := range []bool{config.Output.File.Path != "", config.Output.UnixSocket.Path != "", len(config.Output.Exec.Command) > 0} {
+		if set {
+			destinations++
+		}
+	}
+	if destinations > 1 {
+		log.Error("output.file, output.unix_socket and output.exec are mutually exclusive")
+		os.Exit(1)
+	}
+
+	switch config.Output.Format {
+	case "", "log":
+		var out io.Writer = os.Stdout
+		if path := config.Output.File.Path; path != "" {
+			f := rotatingFile(config)
+			defer f.Close()
+			log.Info("logging to file", "path", path)
+			out = f
+		}
+		if c.batch = newOutputBatch(config, out); c.batch != nil {
+			defer c.batch.Close()
+			out = c.batch
+		}
+		if out != os.Stdout {
+			log.Root().SetHandler(logHandler(out))
+		}
+	case "protojson":
+		var out io.Writer = os.Stdout
+		if path := config.Output.File.Path; path != "" {
+			f := rotatingFile(config)
+			defer f.Close()
+			out = f
+		}
+		if path := config.Output.UnixSocket.Path; path != "" {
+			uds, err := newUnixSocketWriter(path, config.Output.UnixSocket.Mode)
+			if err != nil {
+				log.Error("unix socket output", "path", path, "err", err)
+				os.Exit(1)
+			}
+			defer uds.Close()
+			out = uds
+		}
+		if argv := config.Output.Exec.Command; len(argv) > 0 {
+			ew, err := newExecWriter(argv, config.Output.Exec.Buffer, cancel)
+			if err != nil {
+				log.Error("exec output", "command", argv, "err", err)
+				os.Exit(1)
+			}
+			defer ew.Close()
+			out = ew
+			c.exec = ew
+		}
+		if c.batch = newOutputBatch(config, out); c.batch != nil {
+			defer c.batch.Close()
+			out = c.batch
+		}
+		if len(config.Output.Fields) > 0 && len(streamTypes) > 1 {
+			log.Error("output.fields selects fields of one message type and needs a single stream type")
+			os.Exit(1)
+		}
+		c.json, err = newProtoJSONWriter(out, streamTypes[0], config.Output.Fields)
 		if err != nil {
-			log.Error("transactions subscribe", "err", err)
+			log.Error("protojson output", "err", err)
 			os.Exit(1)
 		}
-		consumeParsedTransactions(strm)
-	case "transfers":
-		req := &proto.SubscribeTransfersRequest{
-			Sender:   addrFilterFromSlice(config.Filters.Senders),
-			Receiver: addrFilterFromSlice(config.Filters.Receivers),
-			Token:    addrFilterFromSlice(config.Filters.Tokens),
+		c.json.rename = config.Output.Rename
+	case "csv":
+		if !slices.Equal(streamTypes, []string{"dex_trades"}) {
+			log.Error("output.format: csv only supports stream.type: dex_trades", "stream.types", strings.Join(streamTypes, ","))
+			os.Exit(1)
 		}
-		log.Info("transfers subscribe", "req", req)
-		strm, err := client.Transfers(streamCtx, req)
+		var out io.Writer = os.Stdout
+		if path := config.Output.File.Path; path != "" {
+			f := rotatingFile(config)
+			defer f.Close()
+			out = f
+		}
+		if c.batch = newOutputBatch(config, out); c.batch != nil {
+			defer c.batch.Close()
+			out = c.batch
+		}
+		c.csv, err = newCSVWriter(out, c.batch != nil)
 		if err != nil {
-			log.Error("transfers subscribe", "err", err)
+			log.Error("csv output", "err", err)
 			os.Exit(1)
 		}
-		consumeTransfersTx(strm)
-	case "balances":
-		req := &proto.SubscribeBalanceUpdateRequest{
-			Address: addrFilterFromSlice(config.Filters.Addresses),
-			Token:   addrFilterFromSlice(config.Filters.Tokens),
+		defer c.csv.Close()
+	default:
+		log.Error("unknown output format", "format", config.Output.Format, "supported", "log|protojson|csv")
+		os.Exit(1)
+	}
+	if err := checkRename(config.Output.Rename, streamTypes); err != nil {
+		log.Error("rename config", "err", err)
+		os.Exit(1)
+	}
+	if len(config.Output.Rename) > 0 && c.csv != nil {
+		log.Warn("output.rename doesn't apply to the csv columns", "format", config.Output.Format)
+	}
+	if config.Output.RecordHash && c.json == nil && len(config.Output.Kafka.Brokers) == 0 {
+		log.Warn("output.record_hash only applies to output.format: protojson and Kafka", "format", config.Output.Format)
+	}
+	if config.Output.UnixSocket.Path != "" && c.json == nil {
+		log.Error("output.unix_socket requires output.format: protojson")
+		os.Exit(1)
+	}
+	if len(config.Output.Exec.Command) > 0 && c.json == nil {
+		log.Error("output.exec requires output.format: protojson")
+		os.Exit(1)
+	}
+
+	if len(config.Output.Kafka.Brokers) > 0 {
+		c.kafka, err = newKafkaSink(config, c.stats)
+		if err != nil {
+			log.Error("kafka output", "err", err)
+			os.Exit(1)
 		}
-		log.Info("balances subscribe", "req", req)
-		strm, err := client.Balances(streamCtx, req)
+		log.Info("publishing to kafka", "brokers", strings.Join(config.Output.Kafka.Brokers, ","), "topic", config.Output.Kafka.Topic)
+	}
+
+	if every := config.Output.FullSampleInterval; every > 0 && c.json == nil {
+		c.sampler = &fullSampler{interval: every}
+	}
+
+	if config.Output.GroupByBlock {
+		if c.tokens != nil {
+			log.Error("output.group_by_block is not supported in distinct_tokens mode")
+			os.Exit(1)
+		}
+		if len(streamTypes) > 1 {
+			log.Error("output.group_by_block needs a single stream type")
+			os.Exit(1)
+		}
+		if c.csv != nil {
+			log.Error("output.group_by_block is not supported with output.format: csv")
+			os.Exit(1)
+		}
+		c.blocks = &blockBatcher{max: config.Output.MaxBlockEvents}
+	}
+
+	if len(config.Output.Redact.Fields) > 0 {
+		c.redact, err = newRedactor(config.Output.Redact.Salt, config.Output.Redact.Fields)
 		if err != nil {
-			log.Error("balances subscribe", "err", err)
+			log.Error("redaction config", "err", err)
 			os.Exit(1)
 		}
-		consumeBalancesTx(strm)
+		c.redact.rename = config.Output.Rename
+	}
+
+	if c.kafka != nil {
+		c.kafka.redact = c.redact
+		c.sinks = append(c.sinks, c.kafka)
+		if c.kafka.spill != nil {
+			// Rewritten on the checkpoint's interval, see kafkaSpill.
+			go c.kafka.spill.run(streamCtx, config.Stream.Checkpoint.Interval)
+		}
+	}
+	// The output.format sink comes last: it may prune or redact the
+	// message in place.
+	switch {
+	case c.json != nil:
+		c.sinks = append(c.sinks, sinkFunc(c.writeJSON))
+	case c.csv != nil:
+		c.sinks = append(c.sinks, sinkFunc(c.writeCSV))
 	default:
-		log.Error("unknown stream type", "type", config.Stream.Type, "supported", "dex_trades|dex_orders|dex_pools|transactions|transfers|balances")
-		os.Exit(1)
+		c.sinks = append(c.sinks, sinkFunc(c.writeConsole))
+	}
+	defer c.closeSinks()
+
+	if interval := config.Output.HeartbeatInterval; interval > 0 {
+		for _, streamType := range streamTypes {
+			go c.runHeartbeat(streamCtx, streamType, interval)
+		}
+	}
+
+	var cp *checkpoint
+	if path := config.Stream.Checkpoint.File; path != "" {
+		cp, err = newCheckpoint(path, c.stats)
+		if err != nil {
+			log.Error("checkpoint load", "path", path, "err", err)
+			os.Exit(1)
+		}
+		go cp.run(streamCtx, config.Stream.Checkpoint.Interval)
+	}
+	cp.resume(streamTypes, config.Stream.FromSlot)
+
+	if interval := config.Stream.LatencyInterval; interval > 0 {
+		for _, streamType := range streamTypes {
+			p := newLatencyProbe(config.RPC.URL, config.RPC.Timeout, c.stats, streamType, interval)
+			go p.run(streamCtx)
+		}
+	}
+
+	if interval := config.Stream.HeartbeatInterval; interval > 0 {
+		go c.runStatsLine(streamCtx, streamTypes, interval)
+	}
+
+	if rf := config.Alerts.RateFloor; rf.MinRate > 0 {
+		for _, streamType := range streamTypes {
+			m := newRateFloorMonitor(c.stats, c.pause, streamType, rf.MinRate, rf.ClearRate, rf.For, rf.Webhook)
+			go m.run(streamCtx)
+		}
+	}
+
+	var health *healthCheck
+	if config.Health.Listen != "" {
+		health = &healthCheck{ctx: streamCtx, stats: c.stats, pause: c.pause, streams: streamTypes, maxStaleness: config.Health.MaxStaleness}
+	}
+	if addr := config.Metrics.Listen; addr != "" {
+		mux := http.NewServeMux()
+		handleMetrics(mux, c.stats, c.matches)
+		paths := []string{"/metrics"}
+		if health != nil && config.Health.Listen == addr {
+			health.register(mux)
+			paths = append(paths, "/healthz", "/readyz", "/pause", "/resume")
+			health = nil
+		}
+		srv, err := startHTTP(addr, mux, paths...)
+		if err != nil {
+			log.Error("metrics listen", "addr", addr, "err", err)
+			os.Exit(1)
+		}
+		defer srv.close()
+	}
+	if health != nil {
+		mux := http.NewServeMux()
+		health.register(mux)
+		srv, err := startHTTP(config.Health.Listen, mux, "/healthz", "/readyz", "/pause", "/resume")
+		if err != nil {
+			log.Error("health listen", "addr", config.Health.Listen, "err", err)
+			os.Exit(1)
+		}
+		defer srv.close()
+	}
+
+	if sp := config.Debug.StallProfile; sp.Dir != "" {
+		if err := os.MkdirAll(sp.Dir, 0o755); err != nil {
+			log.Error("stall profile dir", "path", sp.Dir, "err", err)
+			os.Exit(1)
+		}
+		for _, streamType := range streamTypes {
+			p := &stallProfiler{stats: c.stats, pause: c.pause, stream: streamType, dir: sp.Dir, after: sp.After, cpu: sp.CPUDuration}
+			go p.run(streamCtx)
+		}
+	}
+
+	if *tui {
+		if isatty.IsTerminal(os.Stdout.Fd()) {
+			d := newDashboard(os.Stdout, c.stats)
+			log.Root().SetHandler(levelFilter(d.logHandler()))
+			go d.run(streamCtx)
+		} else {
+			log.Warn("stdout is not a terminal, falling back to plain logging")
+		}
+	}
+	if c.redact != nil {
+		log.Root().SetHandler(c.redact.handler(log.Root().GetHandler()))
+	}
+
+	var wg sync.WaitGroup
+	for _, streamType := range streamTypes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if *replayPath != "" {
+				err = c.replay(streamCtx, *replayPath, streamType)
+			} else {
+				err = c.subscribe(streamCtx, client, streamType)
+			}
+			if err != nil {
+				failed.Store(true)
+			}
+			if err != nil && config.Stream.FailFast && len(streamTypes) > 1 {
+				log.Error("stream failed, stopping the other streams (stream.fail_fast)", "stream", streamType, "err", err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.flushBlock(false)
+	if cp != nil {
+		cp.reportGaps()
+		if err := cp.save(); err != nil {
+			log.Error("checkpoint save", "path", cp.path, "err", err)
+		}
+	}
+	kafkaFailed = c.stats.snapshot().KafkaFailed
+	if pending = c.pendingOutput(); pending > 0 {
+		log.Info("draining output", "pending", pending, "grace_period", config.Shutdown.GracePeriod)
+	}
+	c.enums.report()
+	if n := c.stats.snapshot().Blockless; n > 0 {
+		log.Warn("messages without Block skipped", "count", n)
+	}
+	if n := c.stats.snapshot().Incomplete; n > 0 {
+		log.Warn("incomplete messages skipped", "count", n)
+	}
+	if n := c.stats.snapshot().Duplicates; n > 0 {
+		log.Info("duplicate events dropped", "count", n)
+	}
+	for stream, st := range c.stats.snapshot().Streams {
+		if st.Panics > 0 {
+			log.Warn("messages skipped after a panic", "stream", stream, "count", st.Panics)
+		}
+		if st.OutputErrors > 0 {
+			log.Warn("messages an output failed to write", "stream", stream, "count", st.OutputErrors)
+		}
+	}
+	if n := c.stats.snapshot().ZeroAmount; n > 0 {
+		log.Info("zero amount messages dropped", "count", n)
+	}
+	c.minAmount.report()
+	c.matches.report()
+}
+
+// subscribe consumes one stream type until ctx is cancelled or the stream
+// fails for good, re-subscribing in between.
+func (c *consumer) subscribe(ctx context.Context, client proto.CoreCastClient, streamType string) error {
+	switch streamType {
+	case "dex_trades":
+		req := tradesRequest(c.cfg)
+		log.Info("trades subscribe", "req", req)
+		return c.resubscribe(ctx, "dex_trades", func(ctx context.Context) error {
+			strm, err := client.DexTrades(ctx, req)
+			if err != nil {
+				return err
+			}
+			return withTrailer(strm, recoverConsume(c, "dex_trades", strm, c.consumeDexTrades))
+		})
+	case "dex_orders":
+		req := ordersRequest(c.cfg)
+		log.Info("orders subscribe", "req", req)
+		return c.resubscribe(ctx, "dex_orders", func(ctx context.Context) error {
+			strm, err := client.DexOrders(ctx, req)
+			if err != nil {
+				return err
+			}
+			return withTrailer(strm, recoverConsume(c, "dex_orders", strm, c.consumeDexOrders))
+		})
+	case "dex_pools":
+		req := poolsRequest(c.cfg)
+		log.Info("pools subscribe", "req", req)
+		return c.resubscribe(ctx, "dex_pools", func(ctx context.Context) error {
+			strm, err := client.DexPools(ctx, req)
+			if err != nil {
+				return err
+			}
+			return withTrailer(strm, recoverConsume(c, "dex_pools", strm, c.consumeDexPools))
+		})
+	case "transactions":
+		req := transactionsRequest(c.cfg)
+		log.Info("transactions subscribe", "req", req)
+		return c.resubscribe(ctx, "transactions", func(ctx context.Context) error {
+			strm, err := client.Transactions(ctx, req)
+			if err != nil {
+				return err
+			}
+			return withTrailer(strm, recoverConsume(c, "transactions", strm, c.consumeParsedTransactions))
+		})
+	case "transfers":
+		req := transfersRequest(c.cfg)
+		log.Info("transfers subscribe", "req", req)
+		return c.resubscribe(ctx, "transfers", func(ctx context.Context) error {
+			strm, err := client.Transfers(ctx, req)
+			if err != nil {
+				return err
+			}
+			return withTrailer(strm, recoverConsume(c, "transfers", strm, c.consumeTransfersTx))
+		})
+	case "balances":
+		req := balancesRequest(c.cfg)
+		log.Info("balances subscribe", "req", req)
+		return c.resubscribe(ctx, "balances", func(ctx context.Context) error {
+			strm, err := client.Balances(ctx, req)
+			if err != nil {
+				return err
+			}
+			return withTrailer(strm, recoverConsume(c, "balances", strm, c.consumeBalancesTx))
+		})
 	}
+	return fmt.Errorf("unknown stream type %q", streamType)
+}
+
+// consumer holds the per-run state shared by the consume* functions.
+type consumer struct {
+	cfg          *internal.Config
+	tokens       *tokenTracker // set in distinct_tokens mode
+	firstTrades  *tokenTracker // set in first_trades mode
+	enums        *enumTracker
+	stats        *stats
+	matches      *filterMatches
+	orderStates  map[string]bool  // nil keeps every order state
+	minAmount    *minAmountFilter // nil unless filters.min_amount is set
+	mints        *mintFilter      // nil unless filters.include_mints or exclude_mints is set
+	pause        *pauser
+	limit        *byteLimiter         // nil unless stream.max_bytes_per_sec is set
+	quota        *messageQuota        // nil unless stream.max_messages is set
+	dedup        *dedupFilter         // nil unless dedup.window_size is set
+	json         *protoJSONWriter     // set for output.format: protojson
+	csv          *csvWriter           // set for output.format: csv
+	sinks        []sink               // message outputs, see emit
+	wash         *washDetector        // set when analyzers.wash_trading is enabled
+	prices       *priceChangeDetector // set when analyzers.price_change is enabled
+	priceWebhook *webhookQueue        // analyzers.price_change.webhook, if set
+	owners       *ownerResolver       // set when rpc.url is configured
+	redact       *redactor            // set when output.redact.fields is configured
+	sampler      *fullSampler         // set when output.full_sample_interval is configured
+	kafka        *kafkaSink           // set when output.kafka.brokers is configured
+	exec         *execWriter          // set when output.exec is configured
+	refresher    *tokenRefresher      // set when server.token_provider.refresh_interval is configured
+	batch        *batchWriter         // set when output.batch_size is configured
+	blocks       *blockBatcher        // set when output.group_by_block is enabled
 }
 
-func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+// rotatingFile opens output.file for appending. Each record is written with
+// a single Write, so rotation and shutdown never split a line.
+func rotatingFile(cfg *internal.Config) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   cfg.Output.File.Path,
+		MaxSize:    cfg.Output.File.MaxSizeMB,
+		MaxBackups: cfg.Output.File.MaxBackups,
+	}
+}
+
+// pendingOutput returns the number of records buffered by output.batch_size
+// and the asynchronous sinks, i.e. output.exec and output.kafka, that are
+// still to be written.
+func (c *consumer) pendingOutput() int {
+	n := c.batch.pending()
+	if c.exec != nil {
+		n += c.exec.pending()
+	}
+	if c.kafka != nil {
+		n += c.kafka.pending()
+	}
+	return n
+}
+
+// signalContext cancels the returned context on SIGINT/SIGTERM, which stops
+// receiving but lets main drain the buffered output and close the sinks. If
+// that takes longer than grace, or a second signal arrives, the process
+// exits right away.
+func signalContext(parent context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
 	streamCtx, cancelStream := context.WithCancel(parent)
-	sigCh := make(chan os.Signal, 1)
+	sigCh := make(chan os.Signal, 2)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-sigCh
-		log.Debug("interrupt received, cancelling stream...")
+		log.Info("interrupt received, stopping streams and draining output", "grace_period", grace)
 		cancelStream()
+
+		select {
+		case <-sigCh:
+			log.Warn("second interrupt, exiting without draining")
+		case <-time.After(grace):
+			log.Error("shutdown.grace_period elapsed before the output was drained, exiting")
+		}
+		os.Exit(1)
 	}()
 
 	return streamCtx, cancelStream
 }
 
-func addrFilterFromSlice(addresses []string) *proto.AddressFilter {
-	if len(addresses) == 0 {
-		return nil
-	}
-	return &proto.AddressFilter{Addresses: addresses}
-}
-
-func consumeDexTrades(strm proto.CoreCast_DexTradesClient) {
+func (c *consumer) consumeDexTrades(strm proto.CoreCast_DexTradesClient) error {
 	log.Info("Streaming dex trades. Press Ctrl+C to stop.")
 	for {
-		msg, err := strm.Recv()
+		c.pause.wait(strm.Context(), "dex_trades")
+		v, msg, err := recvTrade(strm)
 		if err != nil {
-			log.Debug("stream end", "err", err)
-			return
+			return err
+		}
+		c.limit.wait(strm.Context(), protobuf.Size(msg))
+		if !v.HasBlock {
+			c.skipBlockless("dex_trades")
+			continue
+		}
+		if !v.Complete {
+			c.skipIncomplete("dex_trades", v.Slot)
+			continue
+		}
+		if c.dedup.duplicate("dex_trades", v.Key) {
+			continue
 		}
+		if !c.quota.take() {
+			continue
+		}
+		c.advance(v.Slot)
 
-		var acc *solana_messages.Account
-		if msg.Trade.Buy != nil {
-			acc = msg.Trade.Buy.Account
-		} else {
-			acc = msg.Trade.Sell.Account
-		}
-
-		market := ""
-		if msg.Trade.Market != nil {
-			market = base58.Encode(msg.Trade.Market.MarketAddress)
-		}
-		log.Info(
-			"Swap",
-			"Slot", msg.Block.Slot,
-			"Success", msg.Transaction.Status.Success,
-			"Signature", base58.Encode(msg.Transaction.Signature),
-			"Sell", base58.Encode(msg.Trade.Sell.Currency.MintAddress),
-			"Buy", base58.Encode(msg.Trade.Buy.Currency.MintAddress),
-			"SellAmount", msg.Trade.Sell.Amount,
-			"BuyAmount", msg.Trade.Buy.Amount,
-			"Account", base58.Encode(acc.Address),
-			"Pool", market,
-			"Program", base58.Encode(msg.Trade.Dex.ProgramAddress),
-		)
+		c.stats.message("dex_trades", v.Slot, v.Buy.Currency.Mint, v.Sell.Currency.Mint)
+		c.matches.match("programs", v.Program)
+		c.matches.match("pools", v.Pool)
+		c.matches.match("tokens", v.Buy.Currency.Mint, v.Sell.Currency.Mint)
+		c.matches.match("traders", v.Buy.Account, v.Sell.Account)
+
+		if c.cfg.Filters.DropZeroAmount && (v.Buy.Amount == 0 || v.Sell.Amount == 0) {
+			c.stats.zeroAmount()
+			continue
+		}
+		if c.minAmount.drop(v.Buy, v.Sell) {
+			continue
+		}
+
+		if c.wash != nil {
+			for _, rec := range c.wash.observe(v.Slot, v.Tx.Signature, v.Tx.Signer, v.Buy.Currency.Mint, v.Sell.Currency.Mint) {
+				c.emitRecord("dex_trades", "WashTradeSuspect", rec)
+			}
+		}
+		if c.prices != nil {
+			if alert, ok := c.prices.observe(v.Slot, v.Buy, v.Sell); ok {
+				c.emitRecord("dex_trades", "PriceChange", alert)
+				c.priceWebhook.post(alert)
+			}
+		}
+
+		if c.tokens != nil {
+			c.tokens.observe(v.Slot, v.Buy.Currency, v.Sell.Currency)
+			continue
+		}
+
+		var fresh []seenToken
+		if c.firstTrades != nil {
+			if fresh = c.firstTrades.add(v.Slot, v.Buy.Currency, v.Sell.Currency); len(fresh) == 0 {
+				continue
+			}
+		}
+
+		c.emit("dex_trades", record{slot: v.Slot, msg: msg, console: func() []consoleRecord {
+			swap := newSwapRecord(v)
+			if fresh == nil {
+				return []consoleRecord{{"Swap", swap}}
+			}
+			mints := make([]string, len(fresh))
+			for i, tok := range fresh {
+				mints[i] = tok.Mint
+			}
+			return []consoleRecord{{"FirstTrade", firstTradeRecord{
+				swapRecord: swap,
+				NewMints:   strings.Join(mints, ","),
+				FirstSeen:  fresh[0].FirstSeen.Format(time.RFC3339),
+			}}}
+		}})
 	}
 }
 
-func consumeDexOrders(strm proto.CoreCast_DexOrdersClient) {
+func newSwapRecord(v tradeView) swapRecord {
+	acc := v.Buy.Account
+	if !v.Buy.Present {
+		acc = v.Sell.Account
+	}
+	return swapRecord{
+		Slot:        v.Slot,
+		Success:     v.Tx.Success,
+		Signature:   encode.Signature(v.Tx.Signature),
+		Sell:        encode.Address(v.Sell.Currency.Mint),
+		Buy:         encode.Address(v.Buy.Currency.Mint),
+		SellAmount:  v.Sell.Amount,
+		BuyAmount:   v.Buy.Amount,
+		SellValue:   amount.Decimal(v.Sell.Amount, v.Sell.Currency.Decimals),
+		BuyValue:    amount.Decimal(v.Buy.Amount, v.Buy.Currency.Decimals),
+		Account:     encode.Address(acc),
+		Pool:        encode.Address(v.Pool),
+		Program:     encode.Address(v.Program),
+		ProgramName: internal.DexName(base58.Encode(v.Program)),
+	}
+}
+
+func (c *consumer) consumeDexOrders(strm proto.CoreCast_DexOrdersClient) error {
 	log.Info("Streaming dex orders. Press Ctrl+C to stop.")
 	for {
-		msg, err := strm.Recv()
+		c.pause.wait(strm.Context(), "dex_orders")
+		v, msg, err := recvOrder(strm)
 		if err != nil {
-			log.Debug("stream end", "err", err)
-			return
-		}
-
-		order := msg.Order.Order
-		log.Info(
-			"Order",
-			"OrderId", base58.Encode(order.OrderId),
-			"BuySide", order.BuySide,
-			"LimitPrice", order.LimitPrice,
-			"LimitAmount", order.LimitAmount,
-			"Account", base58.Encode(order.Account),
-			"Pool", base58.Encode(msg.Order.Market.MarketAddress),
-			"Program", base58.Encode(msg.Order.Dex.ProgramAddress),
-			"BaseMint", base58.Encode(msg.Order.Market.BaseCurrency.MintAddress),
-			"QuoteMint", base58.Encode(msg.Order.Market.QuoteCurrency.MintAddress),
-		)
+			return err
+		}
+		c.limit.wait(strm.Context(), protobuf.Size(msg))
+		if !v.HasBlock {
+			c.skipBlockless("dex_orders")
+			continue
+		}
+		if !v.Complete {
+			c.skipIncomplete("dex_orders", v.Slot)
+			continue
+		}
+		if c.dedup.duplicate("dex_orders", v.Key) {
+			continue
+		}
+		if !c.quota.take() {
+			continue
+		}
+		c.advance(v.Slot)
+
+		c.stats.message("dex_orders", v.Slot, v.Base.Mint, v.Quote.Mint)
+		c.matches.match("programs", v.Program)
+		c.matches.match("pools", v.Pool)
+		c.matches.match("tokens", v.Base.Mint, v.Quote.Mint)
+		c.matches.match("traders", v.Account)
+
+		state := c.enums.label(v.Type)
+		if c.orderStates != nil && !c.orderStates[state] {
+			continue
+		}
+
+		if c.tokens != nil {
+			c.tokens.observe(v.Slot, v.Base, v.Quote)
+			continue
+		}
+
+		c.emit("dex_orders", record{slot: v.Slot, msg: msg, console: func() []consoleRecord {
+			return []consoleRecord{{"Order", orderRecord{
+				Type:        state,
+				OrderID:     encode.Address(v.OrderID),
+				BuySide:     v.BuySide,
+				LimitPrice:  v.LimitPrice,
+				LimitAmount: v.LimitAmount,
+				Account:     encode.Address(v.Account),
+				Pool:        encode.Address(v.Pool),
+				Program:     encode.Address(v.Program),
+				BaseMint:    encode.Address(v.Base.Mint),
+				QuoteMint:   encode.Address(v.Quote.Mint),
+			}}}
+		}})
 	}
 }
 
-func consumeDexPools(strm proto.CoreCast_DexPoolsClient) {
+func (c *consumer) consumeDexPools(strm proto.CoreCast_DexPoolsClient) error {
 	log.Info("Streaming dex pool events. Press Ctrl+C to stop.")
 	for {
-		msg, err := strm.Recv()
+		c.pause.wait(strm.Context(), "dex_pools")
+		v, msg, err := recvPoolEvent(strm)
 		if err != nil {
-			log.Debug("stream end", "err", err)
-			return
-		}
-
-		evt := msg.PoolEvent
-		log.Info(
-			"PoolEvent",
-			"BaseChange", evt.BaseCurrency.ChangeAmount,
-			"QuoteChange", evt.QuoteCurrency.ChangeAmount,
-			"Program", base58.Encode(msg.PoolEvent.Dex.ProgramAddress),
-			"BaseMint", base58.Encode(evt.Market.BaseCurrency.MintAddress),
-			"QuoteMint", base58.Encode(evt.Market.QuoteCurrency.MintAddress),
-			"Pool", base58.Encode(evt.Market.MarketAddress),
-		)
+			return err
+		}
+		c.limit.wait(strm.Context(), protobuf.Size(msg))
+		if !v.HasBlock {
+			c.skipBlockless("dex_pools")
+			continue
+		}
+		if !v.Complete {
+			c.skipIncomplete("dex_pools", v.Slot)
+			continue
+		}
+		if c.dedup.duplicate("dex_pools", v.Key) {
+			continue
+		}
+		if !c.quota.take() {
+			continue
+		}
+		c.advance(v.Slot)
+
+		c.stats.message("dex_pools", v.Slot, v.Base.Mint, v.Quote.Mint)
+		c.matches.match("programs", v.Program)
+		c.matches.match("pools", v.Pool)
+		c.matches.match("tokens", v.Base.Mint, v.Quote.Mint)
+
+		if c.tokens != nil {
+			c.tokens.observe(v.Slot, v.Base, v.Quote)
+			continue
+		}
+
+		c.emit("dex_pools", record{slot: v.Slot, msg: msg, console: func() []consoleRecord {
+			return []consoleRecord{{"PoolEvent", poolEventRecord{
+				BaseChange:  v.BaseChange,
+				QuoteChange: v.QuoteChange,
+				Program:     encode.Address(v.Program),
+				BaseMint:    encode.Address(v.Base.Mint),
+				QuoteMint:   encode.Address(v.Quote.Mint),
+				Pool:        encode.Address(v.Pool),
+			}}}
+		}})
 	}
 }
 
-func consumeParsedTransactions(strm proto.CoreCast_TransactionsClient) {
+func (c *consumer) consumeParsedTransactions(strm proto.CoreCast_TransactionsClient) error {
 	log.Info("Streaming parsed transactions. Press Ctrl+C to stop.")
 	for {
-		msg, err := strm.Recv()
+		c.pause.wait(strm.Context(), "transactions")
+		v, msg, err := recvTransaction(strm)
 		if err != nil {
-			log.Debug("stream end", "err", err)
-			return
+			return err
+		}
+		c.limit.wait(strm.Context(), protobuf.Size(msg))
+		if !v.HasBlock {
+			c.skipBlockless("transactions")
+			continue
+		}
+		if !v.Complete {
+			c.skipIncomplete("transactions", v.Slot)
+			continue
+		}
+		if c.dedup.duplicate("transactions", v.Key) {
+			continue
+		}
+		if !c.quota.take() {
+			continue
 		}
+		c.advance(v.Slot)
+
+		c.stats.message("transactions", v.Slot)
+		var programs [][]byte
+		for _, ix := range v.Instructions {
+			programs = append(programs, ix.Program)
+		}
+		c.matches.match("programs", programs...)
+		c.matches.match("signers", v.Tx.Signer)
+
+		value, known := transactionLamports(v.Tx.Fee, v.BalanceChanges)
+		if known && value < solToLamports(c.cfg.Filters.MinSOLValue) {
+			continue
+		}
+
+		var programLogs []string
+		if c.cfg.ProgramLogs.Enabled {
+			for _, ix := range v.Instructions {
+				for _, line := range ix.Logs {
+					if strings.Contains(line, c.cfg.ProgramLogs.Contains) {
+						programLogs = append(programLogs, line)
+					}
+				}
+			}
+			if c.cfg.ProgramLogs.Contains != "" && len(programLogs) == 0 {
+				continue
+			}
+		}
+
+		c.emit("transactions", record{slot: v.Slot, msg: msg, console: func() []consoleRecord {
+			var budget computeBudget
+			for _, ix := range v.Instructions {
+				budget.add(ix.Program, ix.Depth == 0, ix.Data)
+			}
 
-		signerCount := 0
-		if msg.Transaction.Header != nil {
-			for _, acc := range msg.Transaction.Header.Accounts {
-				if acc != nil && acc.IsSigner {
+			signerCount := 0
+			for _, acc := range v.Tx.Accounts {
+				if acc.IsSigner {
 					signerCount++
 				}
 			}
+			tx := consoleRecord{"ParsedTransaction", transactionRecord{
+				Slot:          v.Slot,
+				Signature:     encode.Signature(v.Tx.Signature),
+				Instructions:  len(v.Instructions),
+				Signers:       signerCount,
+				Signer:        encode.Address(v.Tx.Signer),
+				Status:        v.Tx.Success,
+				SOLValue:      formatLamports(value),
+				CULimit:       budget.unitLimit(),
+				CUPrice:       budget.price,
+				PriorityFee:   budget.priorityFee(),
+				ComputeBudget: budget.explicit(),
+			}}
+			return append([]consoleRecord{tx}, c.programLogRecords(v.Tx.Signature, programLogs)...)
+		}})
+	}
+}
+
+// skipBlockless counts a message that arrived without a Block. Such messages
+// carry no slot to report, so they are dropped rather than printed as slot 0.
+func (c *consumer) skipBlockless(stream string) {
+	if c.stats.blockless() == 1 {
+		log.Warn("message without Block skipped, further ones are only counted", "stream", stream)
+	}
+}
+
+// skipIncomplete warns about the first message that lacks its event and
+// counts the rest.
+func (c *consumer) skipIncomplete(stream string, slot uint64) {
+	if c.stats.incomplete() == 1 {
+		log.Warn("incomplete message skipped, further ones are only counted", "stream", stream, "slot", slot)
+	}
+}
+
+// writeJSON is the sink of output.format: protojson. It redacts the
+// message in place, so it has to be the last sink. The client's own records
+// are written as a line each, see writeClientRecord.
+func (c *consumer) writeJSON(_ string, rec record) error {
+	msg := rec.msg
+	if msg == nil {
+		for _, r := range rec.console() {
+			if err := c.writeClientRecord(r); err != nil {
+				return err
+			}
 		}
-		status := false
-		if msg.Transaction.Status != nil {
-			status = msg.Transaction.Status.Success
-		}
-		log.Info(
-			"ParsedTransaction",
-			"Slot", msg.Block.Slot,
-			"Signature", base58.Encode(msg.Transaction.Signature),
-			"Instructions", len(msg.Transaction.ParsedIdlInstructions),
-			"Signers", signerCount,
-			"Signer", base58.Encode(msg.Transaction.Header.Signer),
-			"Status", status,
-		)
+		return nil
+	}
+	if c.redact != nil {
+		c.redact.message(msg.ProtoReflect())
+	}
+	b, err := c.json.encode(msg)
+	if err != nil {
+		return fmt.Errorf("protojson write: %w", err)
+	}
+	b = withRecordHash(b, rec.hash)
+	if c.blocks != nil {
+		c.addEvent(b)
+		return nil
+	}
+	if err := c.json.writeLine(b); err != nil {
+		return fmt.Errorf("protojson write: %w", err)
+	}
+	return nil
+}
+
+// accountOwner returns the wallet behind a balance update account: the
+// token owner carried in the message, else an RPC lookup when configured,
+// else the account address itself (which is the wallet for native SOL).
+// The address is also the fallback while the lookup is pending or after it
+// failed; the owner shows up on the account's later updates. It is base58
+// whatever the output encoding, as the RPC lookup needs.
+func (c *consumer) accountOwner(acc accountView, native bool) string {
+	if len(acc.TokenOwner) > 0 {
+		return base58.Encode(acc.TokenOwner)
+	}
+	address := base58.Encode(acc.Address)
+	if c.owners == nil || native {
+		return address
+	}
+	if owner, ok := c.owners.owner(address); ok {
+		return owner
 	}
+	return address
 }
 
-func consumeTransfersTx(strm proto.CoreCast_TransfersClient) {
+// programLogRecords returns the ProgramLog records of a transaction's log
+// lines, capped at program_logs.max_lines so a noisy transaction can't
+// flood the output.
+func (c *consumer) programLogRecords(signature []byte, lines []string) []consoleRecord {
+	limit := c.cfg.ProgramLogs.MaxLines
+	var recs []consoleRecord
+	for i, line := range lines {
+		if i == limit {
+			return append(recs, consoleRecord{"ProgramLog", programLogRecord{Signature: encode.Signature(signature), Omitted: len(lines) - limit}})
+		}
+		recs = append(recs, consoleRecord{"ProgramLog", programLogRecord{Signature: encode.Signature(signature), Line: line}})
+	}
+	return recs
+}
+
+func (c *consumer) consumeTransfersTx(strm proto.CoreCast_TransfersClient) error {
 	log.Info("Streaming tx transfers. Press Ctrl+C to stop.")
 	for {
-		msg, err := strm.Recv()
+		c.pause.wait(strm.Context(), "transfers")
+		v, msg, err := recvTransfer(strm)
 		if err != nil {
-			log.Debug("stream end", "err", err)
-			return
-		}
-
-		t := msg.Transfer
-
-		log.Info(
-			"Transfer",
-			"Slot", msg.Block.Slot,
-			"TxIndex", msg.Transaction.Index,
-			"Sign", base58.Encode(msg.Transaction.Signature),
-			"Mint", base58.Encode(t.Currency.MintAddress),
-			"Sender", base58.Encode(t.Sender.Address),
-			"Receiver", base58.Encode(t.Receiver.Address),
-			"Amount", t.Amount,
-			"InstructionIndex", t.InstructionIndex,
-		)
+			return err
+		}
+		c.limit.wait(strm.Context(), protobuf.Size(msg))
+		if !v.HasBlock {
+			c.skipBlockless("transfers")
+			continue
+		}
+		if !v.Complete {
+			c.skipIncomplete("transfers", v.Slot)
+			continue
+		}
+		if c.dedup.duplicate("transfers", v.Key) {
+			continue
+		}
+		if !c.quota.take() {
+			continue
+		}
+		c.advance(v.Slot)
+
+		c.stats.message("transfers", v.Slot, v.Currency.Mint)
+		c.matches.match("senders", v.Sender)
+		c.matches.match("receivers", v.Receiver)
+		c.matches.match("tokens", v.Currency.Mint)
+
+		if c.cfg.Filters.DropZeroAmount && v.Amount == 0 {
+			c.stats.zeroAmount()
+			continue
+		}
+		if !c.mints.keep(v.Currency.Mint) {
+			continue
+		}
+
+		kind := transferKind(v.Currency)
+		if want := c.cfg.Filters.TransferKind; want != "" && kind != want {
+			continue
+		}
+		if idx := c.cfg.Filters.TransferInstructionIndexes; len(idx) > 0 && !slices.Contains(idx, v.InstructionIndex) {
+			continue
+		}
+		if min := c.cfg.Filters.TransferMinAmount; min > 0 {
+			if value, _ := amount.Float(v.Amount, v.Currency.Decimals).Float64(); value < min {
+				continue
+			}
+		}
+
+		if c.tokens != nil {
+			c.tokens.observe(v.Slot, v.Currency)
+			continue
+		}
+
+		c.emit("transfers", record{slot: v.Slot, msg: msg, console: func() []consoleRecord {
+			return []consoleRecord{{"Transfer", transferRecord{
+				Slot:             v.Slot,
+				TxIndex:          v.Tx.Index,
+				Sign:             encode.Signature(v.Tx.Signature),
+				Mint:             encode.Address(v.Currency.Mint),
+				TransferKind:     kind,
+				Sender:           encode.Address(v.Sender),
+				Receiver:         encode.Address(v.Receiver),
+				Amount:           v.Amount,
+				InstructionIndex: v.InstructionIndex,
+			}}}
+		}})
 	}
 }
 
-func consumeBalancesTx(strm proto.CoreCast_BalancesClient) {
+func (c *consumer) consumeBalancesTx(strm proto.CoreCast_BalancesClient) error {
 	log.Info("Streaming tx balances. Press Ctrl+C to stop.")
 	for {
-		msg, err := strm.Recv()
+		c.pause.wait(strm.Context(), "balances")
+		v, msg, err := recvBalance(strm)
 		if err != nil {
-			log.Debug("stream end", "err", err)
-			return
+			return err
 		}
+		c.limit.wait(strm.Context(), protobuf.Size(msg))
+		if !v.HasBlock {
+			c.skipBlockless("balances")
+			continue
+		}
+		if !v.Complete {
+			c.skipIncomplete("balances", v.Slot)
+			continue
+		}
+		if c.dedup.duplicate("balances", v.Key) {
+			continue
+		}
+		if !c.quota.take() {
+			continue
+		}
+		c.advance(v.Slot)
 
-		b := msg.BalanceUpdate
+		var (
+			acc    accountView
+			hasAcc = int(v.AccountIndex) < len(v.Tx.Accounts)
+		)
+		if hasAcc {
+			acc = v.Tx.Accounts[v.AccountIndex]
+		}
 
-		var address string
-		idx := b.BalanceUpdate.AccountIndex
-		if acc := msg.Transaction.Header.Accounts[idx]; acc != nil && acc.Address != nil {
-			address = base58.Encode(acc.Address)
+		c.stats.message("balances", v.Slot, v.Currency.Mint)
+		c.matches.match("addresses", acc.Address)
+		c.matches.match("tokens", v.Currency.Mint)
+
+		if c.cfg.Filters.DropZeroAmount && v.Pre == v.Post {
+			c.stats.zeroAmount()
+			continue
+		}
+		if !c.mints.keep(v.Currency.Mint) {
+			continue
 		}
 
-		log.Info(
-			"BalanceUpdate",
-			"Slot", msg.Block.Slot,
-			"TxIndex", msg.Transaction.Index,
-			"Sign", base58.Encode(msg.Transaction.Signature),
-			"Address", address,
-			"Mint", base58.Encode(b.Currency.MintAddress),
-			"Pre", b.BalanceUpdate.PreBalance,
-			"Post", b.BalanceUpdate.PostBalance,
-		)
+		if c.tokens != nil {
+			c.tokens.observe(v.Slot, v.Currency)
+			continue
+		}
+
+		c.emit("balances", record{slot: v.Slot, msg: msg, console: func() []consoleRecord {
+			var address, owner string
+			if hasAcc && acc.Address != nil {
+				address = encode.Address(acc.Address)
+				owner = c.accountOwner(acc, v.Currency.Native)
+			}
+
+			delta, deltaValue := amount.Delta(v.Pre, v.Post, v.Currency.Decimals)
+			return []consoleRecord{{"BalanceUpdate", balanceRecord{
+				Slot:       v.Slot,
+				TxIndex:    v.Tx.Index,
+				Sign:       encode.Signature(v.Tx.Signature),
+				Address:    address,
+				Owner:      owner,
+				Mint:       encode.Address(v.Currency.Mint),
+				Pre:        v.Pre,
+				Post:       v.Post,
+				Delta:      delta,
+				DeltaValue: deltaValue,
+			}}}
+		}})
 	}
 }
 
-func NewConnection(cfg *internal.Config) (*grpc.ClientConn, context.Context, error) {
+// NewConnection creates the client connection configured by cfg, with the
+// extra dial options appended, and a context derived from ctx carrying its
+// authorization. Canceling ctx stops fetching the token.
+func NewConnection(ctx context.Context, cfg *internal.Config, extra ...grpc.DialOption) (*grpc.ClientConn, context.Context, error) {
+	token := cfg.Server.Authorization
+	if cfg.Server.TokenProvider.Type != "" {
+		provider, err := newTokenProvider(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		token, err = fetchToken(ctx, provider, cfg.Server.TokenProvider.Attempts, cfg.Server.TokenProvider.Timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Debug("authorization token obtained", "provider", cfg.Server.TokenProvider.Type)
+	}
+
+	if err := checkInsecureAuth(cfg, token); err != nil {
+		return nil, nil, err
+	}
+
 	ka := keepalive.ClientParameters{
-		Time:                15 * time.Second,
-		Timeout:             5 * time.Second,
-		PermitWithoutStream: true,
+		Time:                cfg.Server.Keepalive.Time,
+		Timeout:             cfg.Server.Keepalive.Timeout,
+		PermitWithoutStream: *cfg.Server.Keepalive.PermitWithoutStream,
 	}
+	log.Debug("grpc keepalive", "time", ka.Time, "timeout", ka.Timeout, "permit_without_stream", ka.PermitWithoutStream)
 
 	var transport credentials.TransportCredentials
 	if cfg.Server.Insecure {
 		transport = insecure.NewCredentials()
 		log.Debug("grpc transport", "mode", "insecure")
 	} else {
-		transport = credentials.NewTLS(&tls.Config{})
-		log.Debug("grpc transport", "mode", "tls")
+		tlsConfig, err := clientTLSConfig(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		transport = credentials.NewTLS(tlsConfig)
+		log.Debug("grpc transport", "mode", "tls", "ca_file", cfg.Server.TLS.CAFile, "client_cert", cfg.Server.TLS.CertFile != "")
 	}
 
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(transport),
-		grpc.WithInitialWindowSize(8 << 20),
-		grpc.WithInitialConnWindowSize(64 << 20),
+		grpc.WithInitialWindowSize(cfg.Tuning.InitialWindowSize),
+		grpc.WithInitialConnWindowSize(cfg.Tuning.InitialConnWindowSize),
 		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(32<<20),
-			grpc.MaxCallSendMsgSize(32<<20),
+			grpc.MaxCallRecvMsgSize(cfg.Tuning.MaxRecvMsgSize),
+			grpc.MaxCallSendMsgSize(cfg.Tuning.MaxSendMsgSize),
 		),
-		grpc.WithReadBufferSize(2 << 20),
-		grpc.WithWriteBufferSize(2 << 20),
+		grpc.WithReadBufferSize(cfg.Tuning.ReadBufferSize),
+		grpc.WithWriteBufferSize(cfg.Tuning.WriteBufferSize),
 		grpc.WithKeepaliveParams(ka),
 	}
+	if name := cfg.Server.Compression; name != "" && name != "none" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(name)))
+		log.Debug("grpc compression", "compressor", name)
+	}
+	if tk := cfg.Tuning.TCPKeepalive; tk.Enabled {
+		opts = append(opts, grpc.WithContextDialer(tcpKeepaliveDialer(tk.Idle, tk.Interval, tk.Count)))
+		log.Debug("tcp keepalive", "idle", tk.Idle, "interval", tk.Interval, "count", tk.Count)
+	}
+	opts = append(opts, extra...)
 
 	log.Debug("dialing grpc", "address", cfg.Server.Address)
 	conn, err := grpc.NewClient(cfg.Server.Address, opts...)
@@ -378,12 +1299,69 @@ func NewConnection(cfg *internal.Config) (*grpc.ClientConn, context.Context, err
 		return nil, nil, err
 	}
 
-	ctx := context.Background()
-	if cfg.Server.Authorization != "" {
-		md := metadata.New(map[string]string{"authorization": cfg.Server.Authorization})
-		ctx = metadata.NewOutgoingContext(ctx, md)
-		log.Debug("authorization metadata attached")
+	if token != "" {
+		ctx = metadata.NewOutgoingContext(ctx, authMetadata(cfg, token))
+		log.Debug("authorization metadata attached", "scheme", cfg.Server.AuthScheme)
 	}
 
 	return conn, ctx, nil
 }
+
+// clientTLSConfig builds the TLS config from server.tls. Without a ca_file
+// the system roots are used, as with an empty tls.Config.
+func clientTLSConfig(cfg *internal.Config) (*tls.Config, error) {
+	t := cfg.Server.TLS
+	tlsConfig := &tls.Config{ServerName: t.ServerName}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("server.tls.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("server.tls.ca_file %s: no PEM certificates found", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.CertFile != "" && t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("server.tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// checkInsecureAuth refuses to send the authorization token over a plaintext
+// connection unless server.allow_insecure_auth is explicitly set.
+func checkInsecureAuth(cfg *internal.Config, token string) error {
+	if !cfg.Server.Insecure || token == "" {
+		return nil
+	}
+	if !cfg.Server.AllowInsecureAuth {
+		return errors.New("authorization token configured with an insecure (plaintext) connection; " +
+			"enable TLS or set server.allow_insecure_auth: true for local testing")
+	}
+	log.Warn("!!! INSECURE: authorization token will be sent over an unencrypted connection !!!",
+		"address", cfg.Server.Address)
+	return nil
+}
+
+// tcpKeepaliveDialer dials TCP with OS-level keepalive probes, so idle
+// connections through NATs and load balancers are kept open independently
+// of the HTTP/2 pings configured by WithKeepaliveParams. Zero values keep
+// the OS defaults.
+func tcpKeepaliveDialer(idle, interval time.Duration, count int) func(context.Context, string) (net.Conn, error) {
+	d := &net.Dialer{
+		KeepAliveConfig: net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     idle,
+			Interval: interval,
+			Count:    count,
+		},
+	}
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	solana_messages "github.com/bitquery/streaming_protobuf/v2/solana/messages"
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
+
+	"corecast-client-example/internal"
+)
+
+func TestMain(m *testing.M) {
+	// The consumers log every record; keep that out of the test output.
+	log.Root().SetHandler(log.DiscardHandler())
+	os.Exit(m.Run())
+}
+
+// fakeStream serves msgs to a consume function, then io.EOF. Only Recv and
+// Context are implemented; the embedded nil ClientStream panics on the rest.
+type fakeStream[T any] struct {
+	grpc.ClientStream
+	msgs []*T
+}
+
+func (s *fakeStream[T]) Context() context.Context { return context.Background() }
+
+func (s *fakeStream[T]) Recv() (*T, error) {
+	if len(s.msgs) == 0 {
+		return nil, io.EOF
+	}
+	m := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return m, nil
+}
+
+// newTestConsumer returns a consumer with the mandatory parts of main's and
+// every optional stage off.
+func newTestConsumer(cfg *internal.Config, streamTypes ...string) *consumer {
+	return &consumer{
+		cfg:     cfg,
+		enums:   newEnumTracker(),
+		stats:   newStats(),
+		matches: newFilterMatches(streamTypes, cfg),
+		pause:   newPauser(),
+	}
+}
+
+// consumeAll runs consume over msgs and fails the test unless it ends with
+// the io.EOF of the exhausted stream.
+func consumeAll[T any](t *testing.T, consume func(grpc.ServerStreamingClient[T]) error, msgs ...*T) {
+	t.Helper()
+	if err := consume(&fakeStream[T]{msgs: msgs}); !errors.Is(err, io.EOF) {
+		t.Fatalf("consume ended with %v, want io.EOF", err)
+	}
+}
+
+func TestConsumeNilBlock(t *testing.T) {
+	tx := &proto.TransactionInfo{Signature: []byte{1, 2, 3}}
+	tests := []struct {
+		stream string
+		run    func(t *testing.T, c *consumer)
+	}{
+		{"dex_trades", func(t *testing.T, c *consumer) {
+			consumeAll(t, c.consumeDexTrades,
+				&proto.DexTradeEventMessage{Transaction: tx, Trade: &solana_messages.DexTradeEvent{}},
+				&proto.DexTradeEventMessage{})
+		}},
+		{"dex_orders", func(t *testing.T, c *consumer) {
+			consumeAll(t, c.consumeDexOrders,
+				&proto.DexOrderEventMessage{Transaction: tx, Order: &solana_messages.DexOrderEvent{}},
+				&proto.DexOrderEventMessage{})
+		}},
+		{"dex_pools", func(t *testing.T, c *consumer) {
+			consumeAll(t, c.consumeDexPools,
+				&proto.DexPoolEventMessage{Transaction: tx, PoolEvent: &solana_messages.DexPoolEvent{}},
+				&proto.DexPoolEventMessage{})
+		}},
+		{"transactions", func(t *testing.T, c *consumer) {
+			consumeAll(t, c.consumeParsedTransactions,
+				&proto.ParsedTransactionMessage{Transaction: &solana_messages.ParsedIdlTransaction{Signature: []byte{1}}},
+				&proto.ParsedTransactionMessage{})
+		}},
+		{"transfers", func(t *testing.T, c *consumer) {
+			consumeAll(t, c.consumeTransfersTx,
+				&proto.TransferTxMessage{Transaction: tx, Transfer: &solana_messages.Transfer{Amount: 1}},
+				&proto.TransferTxMessage{})
+		}},
+		{"balances", func(t *testing.T, c *consumer) {
+			consumeAll(t, c.consumeBalancesTx,
+				&proto.BalanceUpdateTxMessage{Transaction: tx, BalanceUpdate: &solana_messages.TokenBalanceUpdate{}},
+				&proto.BalanceUpdateTxMessage{})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stream, func(t *testing.T) {
+			cfg := &internal.Config{}
+			cfg.Stream.Type = tt.stream
+			c := newTestConsumer(cfg, tt.stream)
+			tt.run(t, c) // a panic on the nil Block fails the test
+			snap := c.stats.snapshot()
+			if snap.Blockless != 2 {
+				t.Errorf("blockless = %d, want 2", snap.Blockless)
+			}
+			if n := snap.Streams[tt.stream].Messages; n != 0 {
+				t.Errorf("messages = %d, want 0: a message without Block was processed", n)
+			}
+		})
+	}
+}
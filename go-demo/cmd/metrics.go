@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// httpServer serves the client's HTTP endpoints: /metrics and the health
+// checks, on one or two addresses.
+type httpServer struct {
+	srv *http.Server
+}
+
+// startHTTP listens on addr right away, so a port conflict fails at
+// startup, and serves mux in the background until close.
+func startHTTP(addr string, mux *http.ServeMux, paths ...string) (*httpServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	h := &httpServer{srv: &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}}
+	go func() {
+		if err := h.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error("http server", "addr", addr, "err", err)
+		}
+	}()
+	log.Info("serving http", "addr", ln.Addr().String(), "paths", strings.Join(paths, ","))
+	return h, nil
+}
+
+// close stops the server, letting a request in progress finish.
+func (h *httpServer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.srv.Shutdown(ctx); err != nil {
+		log.Warn("http server shutdown", "err", err)
+	}
+}
+
+// handleMetrics serves the client's counters and the filter match counts
+// in the Prometheus text exposition format on /metrics.
+func handleMetrics(mux *http.ServeMux, s *stats, matches *filterMatches) {
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, s.snapshot())
+		matches.writeMetrics(w)
+	})
+}
+
+func writeMetrics(w io.Writer, snap statsSnapshot) {
+	streams := make([]string, 0, len(snap.Streams))
+	for name := range snap.Streams {
+		streams = append(streams, name)
+	}
+	slices.Sort(streams)
+
+	perStream := func(name, typ, help string, value func(streamStats) uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, stream := range streams {
+			fmt.Fprintf(w, "%s{stream=%q} %d\n", name, stream, value(snap.Streams[stream]))
+		}
+	}
+	total := func(name, help string, value uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+
+	perStream("corecast_messages_total", "counter", "Messages received, per stream type.",
+		func(st streamStats) uint64 { return st.Messages })
+	perStream("corecast_last_slot", "gauge", "Highest slot seen, per stream type.",
+		func(st streamStats) uint64 { return st.LastSlot })
+	perStream("corecast_reconnects_total", "counter", "Re-subscribe attempts after the stream ended, per stream type.",
+		func(st streamStats) uint64 { return st.Reconnects })
+	perStream("corecast_rate_limited_total", "counter", "Streams ended by the server with ResourceExhausted (rate limit or quota), per stream type.",
+		func(st streamStats) uint64 { return st.RateLimited })
+	perStream("corecast_stream_resets_total", "counter", "Streams reset by the server (RST_STREAM), per stream type.",
+		func(st streamStats) uint64 { return st.StreamResets })
+	perStream("corecast_panics_total", "counter", "Messages skipped after a panic while processing them (stream.recover_panics), per stream type.",
+		func(st streamStats) uint64 { return st.Panics })
+	perStream("corecast_output_errors_total", "counter", "Messages a sink failed to write, per stream type.",
+		func(st streamStats) uint64 { return st.OutputErrors })
+	perStream("corecast_decode_errors_total", "counter", "Messages that failed to decode, per stream type.",
+		func(st streamStats) uint64 { return st.DecodeErrors })
+	fmt.Fprintf(w, "# HELP corecast_stream_state Where the stream is in the reconnect loop, 1 for its current state and 0 for the others, per stream type.\n# TYPE corecast_stream_state gauge\n")
+	for _, stream := range streams {
+		for _, state := range streamStates {
+			var v int
+			if snap.Streams[stream].State == state {
+				v = 1
+			}
+			fmt.Fprintf(w, "corecast_stream_state{stream=%q,state=%q} %d\n", stream, state, v)
+		}
+	}
+	fmt.Fprintf(w, "# HELP corecast_reconnect_backoff_seconds Delay before the next re-subscribe attempt while reconnecting, 0 otherwise, per stream type.\n# TYPE corecast_reconnect_backoff_seconds gauge\n")
+	for _, stream := range streams {
+		fmt.Fprintf(w, "corecast_reconnect_backoff_seconds{stream=%q} %g\n", stream, snap.Streams[stream].Backoff.Seconds())
+	}
+	fmt.Fprintf(w, "# HELP corecast_latency_seconds Time from block time to receiving the slot's first message, sampled, per stream type.\n# TYPE corecast_latency_seconds histogram\n")
+	for _, stream := range streams {
+		h := snap.Streams[stream].Latency
+		h.write(w, "corecast_latency_seconds", stream)
+	}
+	total("corecast_oversize_total", "Messages rejected for exceeding tuning.max_recv_msg_size.", snap.Oversize)
+	total("corecast_blockless_total", "Messages skipped because they carried no Block.", snap.Blockless)
+	total("corecast_incomplete_total", "Messages skipped because the event itself was missing.", snap.Incomplete)
+	total("corecast_zero_amount_total", "Messages dropped by filters.drop_zero_amount.", snap.ZeroAmount)
+	total("corecast_duplicates_total", "Events dropped as duplicates by dedup.window_size.", snap.Duplicates)
+	total("corecast_kafka_sent_total", "Messages acknowledged by Kafka.", snap.KafkaSent)
+	total("corecast_kafka_failed_total", "Messages that could not be produced to Kafka after retries.", snap.KafkaFailed)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"corecast-client-example/internal"
+)
+
+func TestWriteMetricsStreamState(t *testing.T) {
+	s := newStats()
+	s.setState("dex_trades", stateReconnecting, 1500*time.Millisecond)
+	s.message("transfers", 100)
+	s.setState("balances", stateFailed, 0)
+
+	var b strings.Builder
+	writeMetrics(&b, s.snapshot())
+	out := b.String()
+	for _, line := range []string{
+		`corecast_stream_state{stream="dex_trades",state="reconnecting"} 1`,
+		`corecast_stream_state{stream="dex_trades",state="connected"} 0`,
+		`corecast_reconnect_backoff_seconds{stream="dex_trades"} 1.5`,
+		`corecast_stream_state{stream="transfers",state="connected"} 1`,
+		`corecast_reconnect_backoff_seconds{stream="transfers"} 0`,
+		`corecast_stream_state{stream="balances",state="failed"} 1`,
+		`corecast_messages_total{stream="transfers"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics lack %s", line)
+		}
+	}
+}
+
+func TestStreamResetsCounted(t *testing.T) {
+	c := newTestConsumer(&internal.Config{}, "dex_trades")
+	c.streamEnd("dex_trades", status.Error(codes.Internal, "stream terminated by RST_STREAM with error code: REFUSED_STREAM"))
+	c.streamEnd("dex_trades", status.Error(codes.Unavailable, "connection lost"))
+
+	var b strings.Builder
+	writeMetrics(&b, c.stats.snapshot())
+	if line := `corecast_stream_resets_total{stream="dex_trades"} 1`; !strings.Contains(b.String(), line+"\n") {
+		t.Errorf("metrics lack %s", line)
+	}
+}
+
+func TestResubscribeState(t *testing.T) {
+	cfg := loadTestConfig(t, "server:\n  address: x\n  connect_retries: 2\n  connect_backoff: 1ms\nstream:\n  type: dex_trades\n  max_backoff: 1ms\nfilters:\n  allow_empty: true\n")
+	c := newTestConsumer(cfg, "dex_trades")
+	err := c.resubscribe(t.Context(), "dex_trades", func(ctx context.Context) error {
+		return status.Error(codes.Unavailable, "down")
+	})
+	if err == nil {
+		t.Fatal("resubscribe didn't give up after server.connect_retries")
+	}
+	if st := c.stats.snapshot().Streams["dex_trades"]; st.State != stateFailed || st.Backoff != 0 {
+		t.Errorf("state %s, backoff %s after giving up, want failed, 0", st.State, st.Backoff)
+	}
+}
+
+func TestFilterMatchMetrics(t *testing.T) {
+	cfg := &internal.Config{}
+	cfg.Filters.Programs = []string{"11111111111111111111111111111111", "Vote111111111111111111111111111111111111111"}
+	m := newFilterMatches([]string{"transactions"}, cfg)
+	m.match("programs", make([]byte, 32))
+
+	var b strings.Builder
+	m.writeMetrics(&b)
+	out := b.String()
+	for _, line := range []string{
+		`corecast_filter_matches_total{filter="programs",value="11111111111111111111111111111111"} 1`,
+		`corecast_filter_matches_total{filter="programs",value="Vote111111111111111111111111111111111111111"} 0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics lack %s", line)
+		}
+	}
+}
+
+func TestResubscribeBackoffReset(t *testing.T) {
+	cfg := loadTestConfig(t, "server:\n  address: x\n  connect_backoff: 2ms\nstream:\n  type: dex_trades\n  max_backoff: 1m\nfilters:\n  allow_empty: true\n")
+	c := newTestConsumer(cfg, "dex_trades")
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	attempts := 0
+	c.resubscribe(ctx, "dex_trades", func(context.Context) error {
+		attempts++
+		if attempts > 1 {
+			// After an attempt that received messages the delay starts over
+			// from server.connect_backoff.
+			if b := c.stats.snapshot().Streams["dex_trades"].Backoff; b > cfg.Server.ConnectBackoff {
+				t.Errorf("attempt %d waited %s, want at most server.connect_backoff", attempts, b)
+			}
+		}
+		if attempts == 3 {
+			cancel()
+		}
+		c.stats.message("dex_trades", uint64(attempts))
+		return status.Error(codes.Unavailable, "down")
+	})
+}
+
+func TestResubscribeOnEOF(t *testing.T) {
+	for _, onEOF := range []bool{false, true} {
+		cfg := loadTestConfig(t, fmt.Sprintf("server:\n  address: x\n  connect_backoff: 1ms\nstream:\n  type: dex_trades\nreconnect:\n  on_eof: %v\nfilters:\n  allow_empty: true\n", onEOF))
+		c := newTestConsumer(cfg, "dex_trades")
+		ctx, cancel := context.WithCancel(t.Context())
+		attempts := 0
+		err := c.resubscribe(ctx, "dex_trades", func(context.Context) error {
+			if attempts++; attempts == 2 {
+				cancel()
+			}
+			return io.EOF
+		})
+		cancel()
+		if want := map[bool]int{false: 1, true: 2}[onEOF]; err != nil || attempts != want {
+			t.Errorf("on_eof %v: %d attempts, err %v, want %d attempts and no error", onEOF, attempts, err, want)
+		}
+	}
+}
+
+func TestResubscribeIdleTimeout(t *testing.T) {
+	cfg := loadTestConfig(t, "server:\n  address: x\n  connect_retries: 1\nstream:\n  type: dex_trades\n  idle_timeout: 20ms\nfilters:\n  allow_empty: true\n")
+	c := newTestConsumer(cfg, "dex_trades")
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	attempts := 0
+	err := c.resubscribe(ctx, "dex_trades", func(ctx context.Context) error {
+		if attempts++; attempts == 4 {
+			cancel()
+		}
+		<-ctx.Done() // the server sends nothing
+		return ctx.Err()
+	})
+	// Idle attempts are not failures: connect_retries would have stopped
+	// after the second one.
+	if err != nil || attempts != 4 {
+		t.Errorf("%d attempts, err %v, want 4 attempts and no error", attempts, err)
+	}
+	if got := c.stats.snapshot().Streams["dex_trades"].Reconnects; got != 3 {
+		t.Errorf("reconnects = %d, want 3", got)
+	}
+}
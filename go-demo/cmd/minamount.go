@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+
+	"corecast-client-example/internal/amount"
+)
+
+// minAmountDefault is the filters.min_amount key applying to every mint
+// without its own entry.
+const minAmountDefault = "*"
+
+// minAmountFilter drops dust trades: those where both sides are below the
+// minimum normalized amount configured for their mint. The running count is
+// logged at most once per interval, so the filter can be seen working.
+type minAmountFilter struct {
+	min      map[string]float64 // mint -> minimum amount in whole tokens
+	interval time.Duration
+	dropped  uint64
+	logged   uint64
+	lastLog  time.Time
+}
+
+func newMinAmountFilter(min map[string]float64) *minAmountFilter {
+	if len(min) == 0 {
+		return nil
+	}
+	return &minAmountFilter{min: min, interval: time.Minute, lastLog: time.Now()}
+}
+
+// below reports whether the side's amount is under its mint's minimum. A
+// mint with neither an own entry nor a default has no minimum.
+func (f *minAmountFilter) below(side tradeSideView) bool {
+	limit, ok := f.min[base58.Encode(side.Currency.Mint)]
+	if !ok {
+		limit, ok = f.min[minAmountDefault]
+	}
+	if !ok {
+		return false
+	}
+	v, _ := amount.Float(side.Amount, side.Currency.Decimals).Float64()
+	return v < limit
+}
+
+// drop reports whether the trade should be dropped, and counts it if so.
+func (f *minAmountFilter) drop(buy, sell tradeSideView) bool {
+	if f == nil || !f.below(buy) || !f.below(sell) {
+		return false
+	}
+	f.dropped++
+	if time.Since(f.lastLog) >= f.interval {
+		f.report()
+	}
+	return true
+}
+
+// report logs the number of dropped trades if it changed since the last time.
+func (f *minAmountFilter) report() {
+	if f == nil || f.dropped == f.logged {
+		return
+	}
+	log.Info("trades below filters.min_amount dropped", "count", f.dropped, "since_last", f.dropped-f.logged)
+	f.logged = f.dropped
+	f.lastLog = time.Now()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/mr-tron/base58"
+)
+
+// mintFilter keeps transfers and balance updates by mint: those of
+// filters.include_mints, if set, minus those of filters.exclude_mints.
+// Native SOL without a mint address counts as the all-zero address.
+type mintFilter struct {
+	include map[string]bool // nil includes every mint
+	exclude map[string]bool
+}
+
+func newMintFilter(include, exclude []string) *mintFilter {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	f := &mintFilter{exclude: make(map[string]bool, len(exclude))}
+	if len(include) > 0 {
+		f.include = make(map[string]bool, len(include))
+		for _, mint := range include {
+			f.include[mint] = true
+		}
+	}
+	for _, mint := range exclude {
+		f.exclude[mint] = true
+	}
+	return f
+}
+
+// keep reports whether events of mint pass the filter. A mint on both
+// lists is excluded.
+func (f *mintFilter) keep(mint []byte) bool {
+	if f == nil {
+		return true
+	}
+	if len(mint) == 0 {
+		mint = nativeMint
+	}
+	key := base58.Encode(mint)
+	if f.exclude[key] {
+		return false
+	}
+	return f.include == nil || f.include[key]
+}
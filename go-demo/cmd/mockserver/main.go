@@ -0,0 +1,60 @@
+// Command mockserver is an in-memory CoreCast server for local development
+// and tests. It serves every stream type with canned messages, so the client
+// can be run without credentials:
+//
+//	go run ./cmd/mockserver -listen :50051
+//
+// and a client config with server.address: "localhost:50051" and
+// server.insecure: true. The server itself is internal/mockserver, which the
+// client's tests also run against.
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"corecast-client-example/internal/mockserver"
+)
+
+func main() {
+	listen := flag.String("listen", ":50051", "Address to listen on")
+	interval := flag.Duration("interval", 100*time.Millisecond, "Delay between the messages of each stream")
+	endAfter := flag.Uint64("end-after", 0, "End every stream after this many messages (0 = never), to exercise reconnects")
+	endCode := flag.String("end-code", "UNAVAILABLE", "gRPC status code ending a stream after -end-after messages; OK ends it cleanly")
+	token := flag.String("token", "", "Authorization metadata required from clients (empty = none)")
+	authHeader := flag.String("auth-header", "authorization", "Metadata key -token is expected in")
+	flag.Parse()
+
+	var code codes.Code
+	if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(*endCode) + `"`)); err != nil {
+		log.Error("invalid -end-code", "code", *endCode, "err", err)
+		os.Exit(1)
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Error("listen", "address", *listen, "err", err)
+		os.Exit(1)
+	}
+	s := grpc.NewServer()
+	proto.RegisterCoreCastServer(s, mockserver.New(mockserver.Options{
+		Interval:   *interval,
+		EndAfter:   *endAfter,
+		EndCode:    code,
+		Token:      *token,
+		AuthHeader: *authHeader,
+	}))
+	log.Info("mock CoreCast server listening", "address", ln.Addr(), "interval", *interval, "end_after", *endAfter, "end_code", code)
+	if err := s.Serve(ln); err != nil {
+		log.Error("serve", "err", err)
+		os.Exit(1)
+	}
+}
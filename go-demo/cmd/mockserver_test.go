@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	"github.com/mr-tron/base58"
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"corecast-client-example/internal"
+	"corecast-client-example/internal/mockserver"
+)
+
+// collectingSink keeps every message it is handed.
+type collectingSink struct {
+	mu   sync.Mutex
+	msgs []protobuf.Message
+}
+
+func (s *collectingSink) handle(_ string, rec record) error {
+	s.mu.Lock()
+	s.msgs = append(s.msgs, rec.msg)
+	s.mu.Unlock()
+	return nil
+}
+
+// startMockServer serves internal/mockserver on a free local port until the
+// test ends and returns its address.
+func startMockServer(t *testing.T, opts mockserver.Options) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	proto.RegisterCoreCastServer(s, mockserver.New(opts))
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return ln.Addr().String()
+}
+
+// loadTestConfig loads body as a config file, so the defaults apply as in
+// a real run.
+func loadTestConfig(t *testing.T, body string) *internal.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := internal.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestSubscribeMockServer(t *testing.T) {
+	const sent = 5
+	addr := startMockServer(t, mockserver.Options{Interval: time.Millisecond, EndAfter: sent})
+	program := "675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8"
+
+	for _, stream := range []string{"dex_trades", "dex_orders", "dex_pools", "transactions", "transfers", "balances"} {
+		t.Run(stream, func(t *testing.T) {
+			cfg := loadTestConfig(t, fmt.Sprintf(`
+server:
+  address: %q
+  insecure: true
+stream:
+  type: %s
+filters:
+  allow_empty: true
+  programs: [%q]
+`, addr, stream, program))
+			conn, ctx, err := NewConnection(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			out := &collectingSink{}
+			c := newTestConsumer(cfg, stream)
+			c.sinks = []sink{out}
+			// The mock ends the stream cleanly after sent messages, which
+			// ends the subscription unless reconnect.on_eof is set.
+			if err := c.subscribe(ctx, proto.NewCoreCastClient(conn), stream); err != nil {
+				t.Fatalf("subscribe: %v", err)
+			}
+			if ctx.Err() != nil {
+				t.Fatal("subscribe didn't stop on EOF")
+			}
+
+			if len(out.msgs) != sent {
+				t.Fatalf("received %d messages, want %d", len(out.msgs), sent)
+			}
+			for i, msg := range out.msgs {
+				slot, sig := messageID(msg.ProtoReflect())
+				if want := base58.Encode(mockserver.Signature(stream, uint64(i+1))); sig != want {
+					t.Errorf("message %d: signature %s, want %s", i+1, sig, want)
+				}
+				if slot == 0 {
+					t.Errorf("message %d: no slot", i+1)
+				}
+			}
+			if st := c.stats.snapshot().Streams[stream]; st.Messages != sent {
+				t.Errorf("stats messages = %d, want %d", st.Messages, sent)
+			}
+			if stream == "dex_trades" {
+				got := out.msgs[0].(*proto.DexTradeEventMessage).GetTrade().GetDex().GetProgramAddress()
+				if base58.Encode(got) != program {
+					t.Errorf("trade program %s, want the filtered %s", base58.Encode(got), program)
+				}
+			}
+		})
+	}
+}
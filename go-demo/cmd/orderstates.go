@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// orderStates validates filters.order_states against the order event type
+// enum of the compiled protos and returns the set of names to keep, or nil
+// when every state is kept.
+func orderStates(states []string) (map[string]bool, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+	values, err := orderStateValues()
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(states))
+	for _, s := range states {
+		if values.ByName(protoreflect.Name(s)) == nil {
+			return nil, fmt.Errorf("filters.order_states: unknown state %q (available: %s)", s, enumNames(values))
+		}
+		keep[s] = true
+	}
+	return keep, nil
+}
+
+// orderStateValues looks up the enum of the Order.Type field of dex_orders messages.
+func orderStateValues() (protoreflect.EnumValueDescriptors, error) {
+	md, err := streamDescriptor("dex_orders")
+	if err != nil {
+		return nil, err
+	}
+	order := md.Fields().ByName("Order")
+	if order == nil || order.Message() == nil {
+		return nil, fmt.Errorf("%s has no Order message field", md.FullName())
+	}
+	typ := order.Message().Fields().ByName("Type")
+	if typ == nil || typ.Enum() == nil {
+		return nil, fmt.Errorf("%s has no Type enum field", order.Message().FullName())
+	}
+	return typ.Enum().Values(), nil
+}
+
+func enumNames(values protoreflect.EnumValueDescriptors) string {
+	names := make([]string, values.Len())
+	for i := range names {
+		names[i] = string(values.Get(i).Name())
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	ownerCacheSize = 100_000
+	// ownerBatchSize is the most accounts getMultipleAccounts accepts.
+	ownerBatchSize = 100
+	// ownerQueueSize bounds the lookups waiting for the background worker;
+	// accounts seen while it is full are looked up on a later update.
+	ownerQueueSize = 4096
+)
+
+// ownerResolver looks up the wallet owning a token account over Solana
+// JSON-RPC for balance updates whose message doesn't carry the owner. The
+// lookups run in the background, batched with getMultipleAccounts, so the
+// receive loop never waits on the RPC node: owner answers from the cache
+// and queues the accounts it misses. Answers are kept in an LRU of
+// ownerCacheSize accounts; failed lookups are not cached and are retried
+// the next time the account is seen.
+type ownerResolver struct {
+	url    string
+	client *http.Client
+	queue  chan string
+
+	mu      sync.Mutex
+	order   *list.List // of ownerEntry, most recent first
+	cache   map[string]*list.Element
+	pending map[string]bool // queued or being looked up
+}
+
+type ownerEntry struct {
+	account, owner string
+}
+
+func newOwnerResolver(url string, timeout time.Duration) *ownerResolver {
+	return &ownerResolver{
+		url:     url,
+		client:  &http.Client{Timeout: timeout},
+		queue:   make(chan string, ownerQueueSize),
+		order:   list.New(),
+		cache:   make(map[string]*list.Element),
+		pending: make(map[string]bool),
+	}
+}
+
+// owner returns the owner of the token account if it is known, or the
+// account itself when the lookup found no token account behind it. ok is
+// false while the account is still to be looked up.
+func (r *ownerResolver) owner(account string) (owner string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.cache[account]; ok {
+		r.order.MoveToFront(e)
+		return e.Value.(ownerEntry).owner, true
+	}
+	if !r.pending[account] {
+		select {
+		case r.queue <- account:
+			r.pending[account] = true
+		default: // worker behind; try again on the next update
+		}
+	}
+	return "", false
+}
+
+// run looks up the queued accounts until ctx is canceled, taking up to
+// ownerBatchSize of them per request.
+func (r *ownerResolver) run(ctx context.Context) {
+	for {
+		var batch []string
+		select {
+		case <-ctx.Done():
+			return
+		case account := <-r.queue:
+			batch = append(batch, account)
+		}
+	collect:
+		for len(batch) < ownerBatchSize {
+			select {
+			case account := <-r.queue:
+				batch = append(batch, account)
+			default:
+				break collect
+			}
+		}
+
+		owners, err := r.lookup(ctx, batch)
+		if err != nil && ctx.Err() == nil {
+			log.Debug("owner lookup failed", "accounts", len(batch), "err", err)
+		}
+		r.mu.Lock()
+		for i, account := range batch {
+			delete(r.pending, account)
+			if err == nil {
+				r.add(account, owners[i])
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// add caches the owner of account, evicting the least recently used entry
+// when full. An empty owner, i.e. no token account, caches the account
+// itself. r.mu must be held.
+func (r *ownerResolver) add(account, owner string) {
+	if owner == "" {
+		owner = account
+	}
+	if e, ok := r.cache[account]; ok {
+		e.Value = ownerEntry{account, owner}
+		r.order.MoveToFront(e)
+		return
+	}
+	r.cache[account] = r.order.PushFront(ownerEntry{account, owner})
+	if r.order.Len() > ownerCacheSize {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.cache, oldest.Value.(ownerEntry).account)
+	}
+}
+
+// lookup returns the token owner of each account, "" for accounts that
+// don't exist or aren't token accounts.
+func (r *ownerResolver) lookup(ctx context.Context, accounts []string) ([]string, error) {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "getMultipleAccounts",
+		"params":  []any{accounts, map[string]string{"encoding": "jsonParsed"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rpc status %s", resp.Status)
+	}
+
+	var out struct {
+		Result struct {
+			Value []*struct {
+				Data struct {
+					Parsed struct {
+						Type string `json:"type"`
+						Info struct {
+							Owner string `json:"owner"`
+						} `json:"info"`
+					} `json:"parsed"`
+				} `json:"data"`
+			} `json:"value"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.Error != nil {
+		return nil, fmt.Errorf("rpc error: %s", out.Error.Message)
+	}
+	if len(out.Result.Value) != len(accounts) {
+		return nil, fmt.Errorf("rpc returned %d accounts for %d", len(out.Result.Value), len(accounts))
+	}
+	owners := make([]string, len(accounts))
+	for i, v := range out.Result.Value {
+		if v != nil && v.Data.Parsed.Type == "account" {
+			owners[i] = v.Data.Parsed.Info.Owner
+		}
+	}
+	return owners, nil
+}
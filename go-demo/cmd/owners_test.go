@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+// fakeRPC answers getMultipleAccounts with the owner of each account in
+// owners, null for the others, or a 500 while fail is set.
+func fakeRPC(t *testing.T, owners map[string]string, fail *atomic.Bool, calls *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		var req struct {
+			Method string
+			Params []json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Method != "getMultipleAccounts" {
+			t.Errorf("unexpected request %+v: %v", req, err)
+		}
+		var accounts []string
+		json.Unmarshal(req.Params[0], &accounts)
+		values := make([]any, len(accounts))
+		for i, a := range accounts {
+			if owner, ok := owners[a]; ok {
+				values[i] = map[string]any{"data": map[string]any{"parsed": map[string]any{"type": "account", "info": map[string]any{"owner": owner}}}}
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"value": values}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// waitOwner polls r until account is resolved.
+func waitOwner(t *testing.T, r *ownerResolver, account string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if owner, ok := r.owner(account); ok {
+			return owner
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("owner of %s not resolved", account)
+	return ""
+}
+
+func TestOwnerResolver(t *testing.T) {
+	var fail atomic.Bool
+	var calls atomic.Int32
+	srv := fakeRPC(t, map[string]string{"token-account": "wallet"}, &fail, &calls)
+	r := newOwnerResolver(srv.URL, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A miss doesn't block and reports the owner as unknown.
+	fail.Store(true)
+	if owner, ok := r.owner("token-account"); ok || owner != "" {
+		t.Fatalf("owner before any lookup = %q, %v", owner, ok)
+	}
+	go r.run(ctx)
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The failed lookup isn't cached: the account is queued again.
+	for {
+		r.mu.Lock()
+		pending := r.pending["token-account"]
+		r.mu.Unlock()
+		if !pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := r.owner("token-account"); ok {
+		t.Fatal("a failed lookup was cached")
+	}
+	fail.Store(false)
+	if owner := waitOwner(t, r, "token-account"); owner != "wallet" {
+		t.Errorf("owner = %q, want wallet", owner)
+	}
+	r.owner("wallet")
+	if owner := waitOwner(t, r, "wallet"); owner != "wallet" {
+		t.Errorf("owner of a non-token account = %q, want the account itself", owner)
+	}
+}
+
+func TestOwnerCacheLRU(t *testing.T) {
+	r := newOwnerResolver("", time.Second)
+	r.mu.Lock()
+	for i := range ownerCacheSize {
+		r.add(strconv.Itoa(i), "owner")
+	}
+	r.mu.Unlock()
+	r.owner(strconv.Itoa(0)) // recently used again
+	r.mu.Lock()
+	r.add("new", "owner")
+	r.mu.Unlock()
+	if _, ok := r.owner(strconv.Itoa(0)); !ok {
+		t.Error("the recently used account was evicted")
+	}
+	if _, ok := r.owner(strconv.Itoa(1)); ok {
+		t.Error("the least recently used account was kept")
+	}
+	if len(r.cache) != ownerCacheSize {
+		t.Errorf("cache holds %d accounts, want %d", len(r.cache), ownerCacheSize)
+	}
+}
+
+func TestAccountOwnerFallback(t *testing.T) {
+	var fail atomic.Bool
+	var calls atomic.Int32
+	acc := accountView{Address: []byte("token-account")}
+	address := base58.Encode(acc.Address)
+	c := &consumer{owners: newOwnerResolver(fakeRPC(t, map[string]string{address: "wallet"}, &fail, &calls).URL, time.Second)}
+
+	// While the lookup is pending the account address stands in for the owner.
+	if owner := c.accountOwner(acc, false); owner != address {
+		t.Fatalf("owner while pending = %q, want the account %q", owner, address)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.owners.run(ctx)
+	waitOwner(t, c.owners, address)
+	if owner := c.accountOwner(acc, false); owner != "wallet" {
+		t.Errorf("owner once resolved = %q, want wallet", owner)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// pauser lets the consumers stop reading from a stream without closing it.
+// While a stream type is paused no Recv is issued on it, so gRPC flow
+// control eventually stops the server from sending more data on that
+// stream; the other stream types keep running. A nil pauser never pauses.
+type pauser struct {
+	mu      sync.Mutex
+	resume  map[string]chan struct{} // stream type -> closed on resume; set while paused
+	resumed map[string]time.Time     // when each stream type was last resumed
+}
+
+func newPauser() *pauser {
+	return &pauser{resume: make(map[string]chan struct{}), resumed: make(map[string]time.Time)}
+}
+
+// set pauses or resumes the given stream types.
+func (p *pauser) set(paused bool, streams ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stream := range streams {
+		ch, isPaused := p.resume[stream]
+		if isPaused == paused {
+			continue
+		}
+		if paused {
+			p.resume[stream] = make(chan struct{})
+			log.Warn("stream paused", "stream", stream)
+		} else {
+			close(ch)
+			delete(p.resume, stream)
+			p.resumed[stream] = time.Now()
+			log.Warn("stream resumed", "stream", stream)
+		}
+	}
+}
+
+// paused reports whether stream is paused.
+func (p *pauser) paused(stream string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.resume[stream]
+	return ok
+}
+
+// idleSince returns when stream last showed activity, given the time of its
+// last message: a resume counts as activity, so the time spent paused isn't
+// reported as a stall once the stream runs again. ok is false while the
+// stream is paused, when it isn't expected to receive anything.
+func (p *pauser) idleSince(stream string, last time.Time) (since time.Time, ok bool) {
+	if p == nil {
+		return last, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, paused := p.resume[stream]; paused {
+		return last, false
+	}
+	if r := p.resumed[stream]; r.After(last) {
+		return r, true
+	}
+	return last, true
+}
+
+// wait blocks while stream is paused or until ctx is done.
+func (p *pauser) wait(ctx context.Context, stream string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	resume, paused := p.resume[stream]
+	p.mu.Unlock()
+	if !paused {
+		return
+	}
+
+	select {
+	case <-resume:
+	case <-ctx.Done():
+	}
+}
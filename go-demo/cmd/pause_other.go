@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// watchPauseSignals is a no-op where SIGUSR1/SIGUSR2 don't exist.
+func watchPauseSignals(ctx context.Context, p *pauser, streams []string) {}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPausePerStream(t *testing.T) {
+	p := newPauser()
+	p.set(true, "transfers")
+	if !p.paused("transfers") || p.paused("dex_trades") {
+		t.Fatal("pausing transfers didn't pause only transfers")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		p.wait(context.Background(), "transfers")
+		close(waited)
+	}()
+	p.wait(context.Background(), "dex_trades") // must not block
+	select {
+	case <-waited:
+		t.Fatal("wait returned while transfers was paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	last := time.Now().Add(-time.Hour)
+	if _, running := p.idleSince("transfers", last); running {
+		t.Error("idleSince reports a paused stream as running")
+	}
+	p.set(false, "transfers")
+	<-waited
+	if since, running := p.idleSince("transfers", last); !running || !since.After(last) {
+		t.Errorf("idleSince after resume = %s, %v; want the resume time", since, running)
+	}
+	if since, _ := p.idleSince("dex_trades", last); !since.Equal(last) {
+		t.Errorf("idleSince of a never paused stream = %s, want its last message", since)
+	}
+}
+
+func TestReadyzSkipsPausedStreams(t *testing.T) {
+	s := newStats()
+	h := &healthCheck{ctx: context.Background(), stats: s, pause: newPauser(), streams: []string{"dex_trades", "transfers"}, maxStaleness: time.Minute}
+	s.message("dex_trades", 1)
+	mux := http.NewServeMux()
+	h.register(mux)
+
+	do := func(method, path string) (int, string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, _ := do(http.MethodGet, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with transfers silent = %d, want 503", code)
+	}
+	if code, _ := do(http.MethodPost, "/pause?stream=transfers"); code != http.StatusOK {
+		t.Fatalf("pause = %d", code)
+	}
+	code, body := do(http.MethodGet, "/readyz")
+	if code != http.StatusOK || !strings.Contains(body, "transfers: paused") {
+		t.Errorf("readyz with transfers paused = %d %q, want 200 and transfers paused", code, body)
+	}
+	if code, _ := do(http.MethodPost, "/pause?stream=balances"); code != http.StatusBadRequest {
+		t.Errorf("pausing a stream that isn't subscribed = %d, want 400", code)
+	}
+	if code, _ := do(http.MethodGet, "/pause"); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /pause = %d, want 405", code)
+	}
+	do(http.MethodPost, "/resume")
+	if h.pause.paused("transfers") {
+		t.Error("resume without stream= didn't resume transfers")
+	}
+}
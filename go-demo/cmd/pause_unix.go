@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchPauseSignals pauses all of streams on SIGUSR1 and resumes them on
+// SIGUSR2.
+func watchPauseSignals(ctx context.Context, p *pauser, streams []string) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-sigCh:
+				p.set(sig == syscall.SIGUSR1, streams...)
+			}
+		}
+	}()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+type pricePair struct {
+	base  string
+	quote string
+}
+
+type pricePoint struct {
+	at    time.Time
+	price float64
+}
+
+// priceAlert is written to the output, and POSTed to the webhook if one is
+// set, when a pair's price moves past the threshold.
+type priceAlert struct {
+	Alert     string    `output:"Alert"`
+	Base      string    `output:"Base"`
+	Quote     string    `output:"Quote"`
+	FromPrice float64   `output:"FromPrice"`
+	ToPrice   float64   `output:"ToPrice"`
+	ChangePct float64   `output:"ChangePct"`
+	Trades    int       `output:"Trades"`
+	Window    string    `output:"Window"`
+	Slot      uint64    `output:"Slot"`
+	Time      time.Time `output:"Time"`
+}
+
+// priceChangeDetector alerts when the price of a token against another moves
+// by more than a percentage within a window. The reference is the oldest
+// trade still inside the window, and at least minTrades trades must be in
+// the window, so a single trade in a thin pool doesn't raise an alert.
+type priceChangeDetector struct {
+	thresholdPct float64
+	window       time.Duration
+	minTrades    int
+	maxTracked   int
+	history      map[pricePair][]pricePoint
+}
+
+func newPriceChangeDetector(thresholdPct float64, window time.Duration, minTrades, maxTracked int) *priceChangeDetector {
+	return &priceChangeDetector{
+		thresholdPct: thresholdPct,
+		window:       window,
+		minTrades:    minTrades,
+		maxTracked:   maxTracked,
+		history:      make(map[pricePair][]pricePoint),
+	}
+}
+
+// observe records the price implied by a trade, and returns an alert if it
+// completes a move. The pair is keyed with the mints in a fixed order, so
+// buys and sells of the same pair share history.
+func (d *priceChangeDetector) observe(slot uint64, buy, sell tradeSideView) (priceAlert, bool) {
+	a, b := buy, sell
+	if base58.Encode(a.Currency.Mint) > base58.Encode(b.Currency.Mint) {
+		a, b = b, a
+	}
+	price, ok := tradePrice(a, b)
+	if !ok {
+		return priceAlert{}, false
+	}
+	pair := pricePair{base: base58.Encode(a.Currency.Mint), quote: base58.Encode(b.Currency.Mint)}
+
+	now := time.Now()
+	points, tracked := d.history[pair]
+	if !tracked && len(d.history) >= d.maxTracked {
+		d.evict(now)
+	}
+	cutoff := now.Add(-d.window)
+	i := 0
+	for i < len(points) && points[i].at.Before(cutoff) {
+		i++
+	}
+	points = append(points[i:], pricePoint{at: now, price: price})
+	d.history[pair] = points
+
+	if len(points) < d.minTrades {
+		return priceAlert{}, false
+	}
+	from := points[0].price
+	change := (price - from) / from * 100
+	if math.Abs(change) < d.thresholdPct {
+		return priceAlert{}, false
+	}
+
+	alert := priceAlert{
+		Alert:     "price_change",
+		Base:      pair.base,
+		Quote:     pair.quote,
+		FromPrice: from,
+		ToPrice:   price,
+		ChangePct: math.Round(change*100) / 100,
+		Trades:    len(points),
+		Window:    d.window.String(),
+		Slot:      slot,
+		Time:      now.UTC(),
+	}
+	// The move is reported once; the current trade becomes the new reference.
+	d.history[pair] = []pricePoint{{at: now, price: price}}
+	return alert, true
+}
+
+// tradePrice returns the price of base in units of quote, adjusted for the
+// decimals of both mints.
+func tradePrice(base, quote tradeSideView) (float64, bool) {
+	if base.Amount == 0 || quote.Amount == 0 || len(base.Currency.Mint) == 0 || len(quote.Currency.Mint) == 0 {
+		return 0, false
+	}
+	b := float64(base.Amount) / math.Pow10(int(base.Currency.Decimals))
+	q := float64(quote.Amount) / math.Pow10(int(quote.Currency.Decimals))
+	return q / b, true
+}
+
+// evict drops pairs without trades inside the window, and if that frees
+// nothing, arbitrary pairs until there is room again.
+func (d *priceChangeDetector) evict(now time.Time) {
+	cutoff := now.Add(-d.window)
+	for pair, points := range d.history {
+		if points[len(points)-1].at.Before(cutoff) {
+			delete(d.history, pair)
+		}
+	}
+	for pair := range d.history {
+		if len(d.history) < d.maxTracked {
+			break
+		}
+		delete(d.history, pair)
+	}
+}
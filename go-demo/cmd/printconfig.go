@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"corecast-client-example/internal"
+)
+
+// printEffectiveConfig writes cfg, as loaded with the environment overrides
+// and defaults applied, as YAML with its secrets redacted. The config is
+// validated afterwards, so an invalid one is still printed for inspection
+// and the problems are returned.
+func printEffectiveConfig(w io.Writer, cfg *internal.Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2) // as in configs/config.yaml
+	if err := enc.Encode(cfg.Redacted()); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
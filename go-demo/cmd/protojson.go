@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// streamMethods maps stream.type to the CoreCast RPC serving it.
+var streamMethods = map[string]protoreflect.Name{
+	"dex_trades":   "DexTrades",
+	"dex_orders":   "DexOrders",
+	"dex_pools":    "DexPools",
+	"transactions": "Transactions",
+	"transfers":    "Transfers",
+	"balances":     "Balances",
+}
+
+// streamDescriptor returns the descriptor of the messages sent on a stream type.
+func streamDescriptor(streamType string) (protoreflect.MessageDescriptor, error) {
+	method, ok := streamMethods[streamType]
+	if !ok {
+		return nil, fmt.Errorf("unknown stream type %q", streamType)
+	}
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName("solana_corecast.CoreCast")
+	if err != nil {
+		return nil, err
+	}
+	svc, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", d.FullName())
+	}
+	m := svc.Methods().ByName(method)
+	if m == nil {
+		return nil, fmt.Errorf("CoreCast has no %s method", method)
+	}
+	return m.Output(), nil
+}
+
+// fieldTree is a field mask split into nested field names.
+type fieldTree map[protoreflect.Name]fieldTree
+
+// protoJSONWriter writes each message as a line of canonical proto JSON,
+// optionally restricted to the fields of a field mask.
+type protoJSONWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	fields fieldTree         // nil writes the whole message
+	rename map[string]string // output.rename, applied to the encoded keys
+	opts   protojson.MarshalOptions
+}
+
+// newProtoJSONWriter validates the field mask paths against the stream's
+// message descriptor so typos fail at startup rather than yielding empty output.
+func newProtoJSONWriter(out io.Writer, streamType string, paths []string) (*protoJSONWriter, error) {
+	w := &protoJSONWriter{out: out, opts: protojson.MarshalOptions{UseProtoNames: true}}
+	if len(paths) == 0 {
+		return w, nil
+	}
+
+	desc, err := streamDescriptor(streamType)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fieldmaskpb.New(dynamicpb.NewMessage(desc), paths...); err != nil {
+		return nil, fmt.Errorf("output.fields: %w", err)
+	}
+
+	w.fields = fieldTree{}
+	for _, path := range paths {
+		node := w.fields
+		for _, name := range strings.Split(path, ".") {
+			child, ok := node[protoreflect.Name(name)]
+			if !ok {
+				child = fieldTree{}
+				node[protoreflect.Name(name)] = child
+			}
+			node = child
+		}
+	}
+	return w, nil
+}
+
+// encode prunes msg in place to the configured fields and returns its JSON,
+// with the keys renamed per output.rename.
+func (w *protoJSONWriter) encode(msg proto.Message) ([]byte, error) {
+	if w.fields != nil {
+		prune(msg.ProtoReflect(), w.fields)
+	}
+	b, err := w.opts.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return renameJSON(b, w.rename)
+}
+
+// writeLine writes one already encoded JSON document followed by a newline.
+func (w *protoJSONWriter) writeLine(b []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(append(b, '\n'))
+	return err
+}
+
+// prune clears every populated field of m that is not selected by tree. A
+// leaf in the tree keeps the whole field, including nested messages.
+func prune(m protoreflect.Message, tree fieldTree) {
+	var drop []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		child, ok := tree[fd.Name()]
+		switch {
+		case !ok:
+			drop = append(drop, fd)
+		case len(child) > 0 && fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			prune(v.Message(), child)
+		}
+		return true
+	})
+	for _, fd := range drop {
+		m.Clear(fd)
+	}
+}
+
+// renameJSON rewrites the object keys of the JSON document b per
+// output.rename, at any depth and keeping the order of the fields; a key
+// renamed to "-" is dropped with its value. The stream messages have no map
+// fields, so every object key in their JSON is a field name.
+func renameJSON(b []byte, rename map[string]string) ([]byte, error) {
+	if len(rename) == 0 {
+		return b, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out bytes.Buffer
+	out.Grow(len(b))
+	if err := renameValue(dec, &out, rename); err != nil {
+		return nil, fmt.Errorf("output.rename: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// renameValue copies the next JSON value from dec to out, renaming the keys
+// of the objects in it.
+func renameValue(dec *json.Decoder, out *bytes.Buffer, rename map[string]string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		v, err := json.Marshal(tok)
+		if err != nil {
+			return err
+		}
+		out.Write(v)
+		return nil
+	}
+
+	object := delim == '{'
+	out.WriteRune(rune(delim))
+	for n := 0; dec.More(); {
+		if object {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := tok.(string)
+			if to, ok := rename[key]; ok {
+				if to == "-" {
+					if err := renameValue(dec, &bytes.Buffer{}, nil); err != nil {
+						return err
+					}
+					continue
+				}
+				key = to
+			}
+			if n > 0 {
+				out.WriteByte(',')
+			}
+			k, _ := json.Marshal(key)
+			out.Write(k)
+			out.WriteByte(':')
+		} else if n > 0 {
+			out.WriteByte(',')
+		}
+		if err := renameValue(dec, out, rename); err != nil {
+			return err
+		}
+		n++
+	}
+	end, err := dec.Token() // the closing delimiter
+	if err != nil {
+		return err
+	}
+	out.WriteRune(rune(end.(json.Delim)))
+	return nil
+}
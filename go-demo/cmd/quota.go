@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// messageQuota stops the streams once stream.max_messages messages have
+// been received, counted across all stream types. Messages without a block
+// or event don't count.
+type messageQuota struct {
+	max    uint64
+	n      atomic.Uint64
+	cancel context.CancelFunc
+}
+
+func newMessageQuota(max uint64, cancel context.CancelFunc) *messageQuota {
+	if max == 0 {
+		return nil
+	}
+	return &messageQuota{max: max, cancel: cancel}
+}
+
+// take counts one message and reports whether it is within the quota. The
+// message that reaches it cancels the streams; the ones the other streams
+// receive before they notice are dropped.
+func (q *messageQuota) take() bool {
+	if q == nil {
+		return true
+	}
+	n := q.n.Add(1)
+	if n == q.max {
+		log.Info("stream.max_messages reached, stopping", "messages", n)
+		q.cancel()
+	}
+	return n <= q.max
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	rateSampleInterval = time.Second
+	// rateSmoothing is the EWMA weight of each one-second sample, which
+	// gives the smoothed rate a time constant of roughly ten seconds.
+	rateSmoothing = 0.1
+)
+
+type rateAlert struct {
+	Alert  string    `json:"Alert"`
+	State  string    `json:"State"` // firing or resolved
+	Stream string    `json:"Stream"`
+	Rate   float64   `json:"Rate"`
+	Floor  float64   `json:"Floor"`
+	Time   time.Time `json:"Time"`
+}
+
+// rateFloorMonitor raises an alert when the smoothed message rate of a stream
+// stays below a floor for a sustained period, and clears it only once the
+// rate is back above a higher clear level, so a rate hovering around the
+// floor doesn't flap. The rate is not sampled while the stream is paused.
+type rateFloorMonitor struct {
+	stats   *stats
+	pause   *pauser
+	stream  string
+	floor   float64
+	clear   float64
+	sustain time.Duration
+	webhook string
+}
+
+func newRateFloorMonitor(s *stats, p *pauser, stream string, floor, clear float64, sustain time.Duration, webhook string) *rateFloorMonitor {
+	return &rateFloorMonitor{
+		stats:   s,
+		pause:   p,
+		stream:  stream,
+		floor:   floor,
+		clear:   clear,
+		sustain: sustain,
+		webhook: webhook,
+	}
+}
+
+func (m *rateFloorMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(rateSampleInterval)
+	defer ticker.Stop()
+
+	var (
+		rate       float64
+		primed     bool
+		prev       = m.stats.snapshot().Streams[m.stream].Messages
+		prevAt     = time.Now()
+		belowSince time.Time
+		firing     bool
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cur := m.stats.snapshot().Streams[m.stream].Messages
+			sample := float64(cur-prev) / now.Sub(prevAt).Seconds()
+			prev, prevAt = cur, now
+			if m.pause.paused(m.stream) {
+				// Start over on resume rather than averaging in the pause.
+				primed, belowSince = false, time.Time{}
+				continue
+			}
+			if !primed {
+				rate, primed = sample, true
+			} else {
+				rate += rateSmoothing * (sample - rate)
+			}
+
+			switch {
+			case !firing && rate < m.floor:
+				if belowSince.IsZero() {
+					belowSince = now
+				}
+				if now.Sub(belowSince) >= m.sustain {
+					firing = true
+					m.notify("firing", rate, now)
+				}
+			case !firing:
+				belowSince = time.Time{}
+			case rate >= m.clear:
+				firing, belowSince = false, time.Time{}
+				m.notify("resolved", rate, now)
+			}
+		}
+	}
+}
+
+func (m *rateFloorMonitor) notify(state string, rate float64, now time.Time) {
+	if state == "firing" {
+		log.Warn("message rate below floor", "stream", m.stream, "rate", fmt.Sprintf("%.2f", rate), "floor", m.floor, "for", m.sustain)
+	} else {
+		log.Info("message rate recovered", "stream", m.stream, "rate", fmt.Sprintf("%.2f", rate), "clear", m.clear)
+	}
+	if m.webhook == "" {
+		return
+	}
+	alert := rateAlert{Alert: "rate_floor", State: state, Stream: m.stream, Rate: rate, Floor: m.floor, Time: now.UTC()}
+	if err := postWebhook(m.webhook, alert); err != nil {
+		log.Error("rate alert webhook", "err", err)
+	}
+}
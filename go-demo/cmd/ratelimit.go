@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// byteLimiter is a token bucket over received bytes. Waiting on it before the
+// next Recv slows down how fast the stream is drained, which in turn makes
+// gRPC flow control hold back the server.
+type byteLimiter struct {
+	mu     sync.Mutex // shared by the consumers of all stream types
+	rate   float64    // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newByteLimiter returns nil when bytesPerSec is zero; a nil limiter never waits.
+func newByteLimiter(bytesPerSec int) *byteLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSec)
+	return &byteLimiter{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+// wait takes n bytes from the bucket, sleeping until they are available or ctx is done.
+func (l *byteLimiter) wait(ctx context.Context, n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	debt := -l.tokens
+	l.mu.Unlock()
+	if debt <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(time.Duration(debt / l.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
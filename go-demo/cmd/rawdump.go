@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/mem"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// A raw dump (output.raw_dump) holds the stream messages exactly as
+// received, before decoding, one frame each:
+//
+//	uint16 big-endian length | message type full name
+//	uint32 big-endian length | protobuf bytes
+//
+// The type name lets -replay pick the messages of each stream type.
+
+// rawDumpCodec is the proto codec, writing every message it decodes to a
+// raw dump first.
+type rawDumpCodec struct {
+	encoding.CodecV2
+	mu  sync.Mutex
+	out io.WriteCloser // nil once a write failed
+}
+
+func newRawDumpCodec(path string) (*rawDumpCodec, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &rawDumpCodec{CodecV2: encoding.GetCodecV2("proto"), out: f}, nil
+}
+
+func (c *rawDumpCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	if m, ok := v.(protobuf.Message); ok {
+		c.dump(m.ProtoReflect().Descriptor().FullName(), data.Materialize())
+	}
+	return c.CodecV2.Unmarshal(data, v)
+}
+
+// dump writes one frame with a single Write, so a frame is never split by
+// a crash between writes. After a failed write dumping stops.
+func (c *rawDumpCodec) dump(name protoreflect.FullName, b []byte) {
+	frame := make([]byte, 0, 6+len(name)+len(b))
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(name)))
+	frame = append(frame, name...)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(b)))
+	frame = append(frame, b...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out == nil {
+		return
+	}
+	if _, err := c.out.Write(frame); err != nil {
+		log.Error("raw dump write failed, dumping stopped", "err", err)
+		c.out.Close()
+		c.out = nil
+	}
+}
+
+func (c *rawDumpCodec) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out == nil {
+		return nil
+	}
+	err := c.out.Close()
+	c.out = nil
+	return err
+}
+
+// readFrame reads the next frame of a raw dump; io.EOF at the end.
+func readFrame(r *bufio.Reader) (protoreflect.FullName, []byte, error) {
+	var n16 [2]byte
+	if _, err := io.ReadFull(r, n16[:]); err != nil {
+		return "", nil, err // io.EOF only between frames
+	}
+	name := make([]byte, binary.BigEndian.Uint16(n16[:]))
+	var n32 [4]byte
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", nil, truncated(err)
+	}
+	if _, err := io.ReadFull(r, n32[:]); err != nil {
+		return "", nil, truncated(err)
+	}
+	b := make([]byte, binary.BigEndian.Uint32(n32[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", nil, truncated(err)
+	}
+	return protoreflect.FullName(name), b, nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// replayStream serves the messages of type T from a raw dump in place of a
+// server stream, skipping the frames of other types. Only Recv and Context
+// are implemented, which is all the consume functions use.
+type replayStream[T any, PT interface {
+	*T
+	protobuf.Message
+}] struct {
+	grpc.ClientStream
+	ctx  context.Context
+	r    *bufio.Reader
+	name protoreflect.FullName
+	n    uint64 // messages served
+}
+
+func (s *replayStream[T, PT]) Context() context.Context { return s.ctx }
+
+func (s *replayStream[T, PT]) Recv() (*T, error) {
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+		name, b, err := readFrame(s.r)
+		if err != nil {
+			return nil, err
+		}
+		if name != s.name {
+			continue
+		}
+		m := PT(new(T))
+		if err := protobuf.Unmarshal(b, m); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", s.n+1, err)
+		}
+		s.n++
+		return m, nil
+	}
+}
+
+// replayDump runs consume over the messages of type T in the raw dump at
+// path, the same way as over a live stream, including stream.recover_panics.
+func replayDump[T any, PT interface {
+	*T
+	protobuf.Message
+}](ctx context.Context, c *consumer, path, stream string, consume func(grpc.ServerStreamingClient[T]) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rs := &replayStream[T, PT]{ctx: ctx, r: bufio.NewReader(f), name: PT(new(T)).ProtoReflect().Descriptor().FullName()}
+	err = recoverConsume(c, stream, rs, consume)
+	switch {
+	case errors.Is(err, io.EOF):
+		log.Info("replay finished", "stream", stream, "messages", rs.n)
+		return nil
+	case ctx.Err() != nil:
+		log.Info("replay stopped", "stream", stream, "messages", rs.n)
+		return nil
+	}
+	log.Error("replay failed", "stream", stream, "path", path, "messages", rs.n, "err", err)
+	return err
+}
+
+// replay feeds the messages of streamType from the raw dump at path to its
+// consume function instead of subscribing.
+func (c *consumer) replay(ctx context.Context, path, streamType string) error {
+	switch streamType {
+	case "dex_trades":
+		return replayDump(ctx, c, path, streamType, c.consumeDexTrades)
+	case "dex_orders":
+		return replayDump(ctx, c, path, streamType, c.consumeDexOrders)
+	case "dex_pools":
+		return replayDump(ctx, c, path, streamType, c.consumeDexPools)
+	case "transactions":
+		return replayDump(ctx, c, path, streamType, c.consumeParsedTransactions)
+	case "transfers":
+		return replayDump(ctx, c, path, streamType, c.consumeTransfersTx)
+	case "balances":
+		return replayDump(ctx, c, path, streamType, c.consumeBalancesTx)
+	}
+	return fmt.Errorf("unknown stream type %q", streamType)
+}
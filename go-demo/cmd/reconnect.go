@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// resubscribe runs subscribe, which opens the stream and consumes it until
+// it fails, and re-subscribes on the same connection with exponential
+// backoff until ctx is cancelled. The request, and so the filters, is the
+// same on every attempt. grpc-go re-dials the connection underneath as
+// needed. Until the first message arrives, e.g. while the server is
+// unreachable at startup, it gives up after server.connect_retries failed
+// attempts. The delay starts at server.connect_backoff, doubles after every
+// attempt that ends without a message, up to stream.max_backoff, and starts
+// over once a message arrives. With stream.idle_timeout, an attempt that
+// received nothing for that long is ended and re-subscribed right away,
+// without counting as a failed attempt. The returned error is non-nil when
+// it gave up on the stream.
+func (c *consumer) resubscribe(ctx context.Context, stream string, subscribe func(context.Context) error) error {
+	backoff := c.cfg.Server.ConnectBackoff
+	connected := false // a message arrived on some attempt
+	idle := 0          // attempts ended by stream.idle_timeout
+	c.stats.setState(stream, stateConnecting, 0)
+	for attempt := 0; ; attempt++ {
+		callCtx := ctx
+		if attempt > 0 && c.cfg.Server.TokenProvider.Type != "" {
+			var err error
+			if callCtx, err = c.refreshToken(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Error("token refresh failed, stopping", "stream", stream, "err", err)
+				return err
+			}
+		}
+
+		received := c.stats.snapshot().Streams[stream].Messages
+		err := classifyRecv(c.watchIdle(callCtx, stream, subscribe))
+		c.streamEnd(stream, err)
+		if ctx.Err() != nil {
+			return nil
+		}
+		class := recvClassOf(err)
+		if class == recvIdle {
+			idle++
+			c.stats.reconnect(stream)
+			continue
+		}
+		if class == recvEOF && !c.cfg.Reconnect.OnEOF {
+			log.Info("not re-subscribing after a clean end (reconnect.on_eof)", "stream", stream)
+			return nil
+		}
+		got := c.stats.snapshot().Streams[stream].Messages > received
+		if !c.retryable(err) {
+			// A token accepted earlier on this stream has likely expired;
+			// token_provider can replace it, once per stream that worked.
+			if !got || status.Code(err) != codes.Unauthenticated || c.cfg.Server.TokenProvider.Type == "" {
+				log.Error("stream failed, not re-subscribing (reconnect.on_codes)", "stream", stream, "class", class, "code", status.Code(err), "err", err)
+				c.stats.setState(stream, stateFailed, 0)
+				return err
+			}
+			log.Warn("token rejected mid-stream, re-subscribing with a new one", "stream", stream)
+		}
+
+		if got {
+			connected = true
+			if class != recvRateLimited { // keep backing off until the limit clears
+				backoff = c.cfg.Server.ConnectBackoff
+			}
+		}
+		if retries := c.cfg.Server.ConnectRetries; !connected && retries >= 0 && attempt-idle >= retries {
+			log.Error("could not subscribe, giving up (server.connect_retries)", "stream", stream,
+				"attempts", attempt-idle+1, "class", class, "err", err)
+			c.stats.setState(stream, stateFailed, 0)
+			return err
+		}
+		wait := jitter(backoff)
+		if d, ok := retryAfter(err); ok && d > wait {
+			wait = d
+		}
+		c.stats.setState(stream, stateReconnecting, wait)
+		log.Warn("stream ended, re-subscribing", "stream", stream, "in", wait.Round(time.Millisecond),
+			"last_slot", c.stats.lastSlot(stream), "err", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		c.stats.reconnect(stream)
+		backoff = min(backoff*2, c.cfg.Stream.MaxBackoff)
+	}
+}
+
+// errIdle ends an attempt that received nothing for stream.idle_timeout.
+var errIdle = errors.New("no message for stream.idle_timeout")
+
+// watchIdle runs subscribe and ends it with errIdle once the stream has
+// received nothing for stream.idle_timeout, so that a load balancer that
+// drops idle connections sees a new request before its own timeout, whether
+// or not the keepalive pings still get answers. Idleness is measured like
+// the stall watchdog does, except that the start of the attempt counts as
+// activity: a paused stream is never idle, and a silent stream is
+// re-subscribed once per idle_timeout rather than in a loop.
+func (c *consumer) watchIdle(ctx context.Context, stream string, subscribe func(context.Context) error) error {
+	timeout := c.cfg.Stream.IdleTimeout
+	if timeout <= 0 {
+		return subscribe(ctx)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	start := time.Now()
+	go func() {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				last := c.stats.snapshot().Streams[stream].LastMessage
+				if last.Before(start) {
+					last = start
+				}
+				since, running := c.pause.idleSince(stream, last)
+				if running && now.Sub(since) >= timeout {
+					log.Info("stream idle, re-subscribing (stream.idle_timeout)", "stream", stream,
+						"since", since.Format(time.RFC3339), "last_slot", c.stats.lastSlot(stream))
+					cancel(errIdle)
+					return
+				}
+			}
+		}
+	}()
+	err := subscribe(ctx)
+	if errors.Is(context.Cause(ctx), errIdle) {
+		return errIdle
+	}
+	return err
+}
+
+// retryable reports whether a stream that ended with err is subscribed
+// again: after a clean end, by the server (if reconnect.on_eof is set) or
+// the consume loop, or a status listed in reconnect.on_codes. Everything
+// else is fatal, as it is likely to fail the same way on every attempt.
+func (c *consumer) retryable(err error) bool {
+	if err == nil || recvClassOf(err) == recvEOF {
+		return true
+	}
+	return c.cfg.ReconnectOn(status.Code(err))
+}
+
+// jitter returns a random delay between d/2 and d, so that clients
+// restarted together don't retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d < 2 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
+
+// refreshToken attaches a new token from server.token_provider to ctx,
+// replacing the one sent on the previous subscription. With refresh_interval
+// it is the one last refreshed in the background, if any; otherwise it is
+// fetched now.
+func (c *consumer) refreshToken(ctx context.Context) (context.Context, error) {
+	token := c.refresher.current()
+	if token == "" {
+		provider, err := newTokenProvider(c.cfg)
+		if err != nil {
+			return nil, err
+		}
+		token, err = fetchToken(ctx, provider, c.cfg.Server.TokenProvider.Attempts, c.cfg.Server.TokenProvider.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, authMetadata(c.cfg, token)), nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The console record of each stream type. The `output` tag gives the log key
+// ("name[,omitempty]", "-" to never print the field); output.rename can
+// override a key or hide a field per deployment without touching the code.
+
+type swapRecord struct {
+	Slot        uint64 `output:"Slot"`
+	Success     bool   `output:"Success"`
+	Signature   string `output:"Signature"`
+	Sell        string `output:"Sell"`
+	Buy         string `output:"Buy"`
+	SellAmount  uint64 `output:"SellAmount"`
+	BuyAmount   uint64 `output:"BuyAmount"`
+	SellValue   string `output:"SellValue"`
+	BuyValue    string `output:"BuyValue"`
+	Account     string `output:"Account"`
+	Pool        string `output:"Pool"`
+	Program     string `output:"Program"`
+	ProgramName string `output:"ProgramName,omitempty"`
+}
+
+// firstTradeRecord is a swap that is the first trade seen for at least one
+// of its mints (stream.mode: first_trades).
+type firstTradeRecord struct {
+	swapRecord
+	NewMints  string `output:"NewMints"`
+	FirstSeen string `output:"FirstSeen"`
+}
+
+type orderRecord struct {
+	Type        string `output:"Type"`
+	OrderID     string `output:"OrderId"`
+	BuySide     bool   `output:"BuySide"`
+	LimitPrice  uint64 `output:"LimitPrice"`
+	LimitAmount uint64 `output:"LimitAmount"`
+	Account     string `output:"Account"`
+	Pool        string `output:"Pool"`
+	Program     string `output:"Program"`
+	BaseMint    string `output:"BaseMint"`
+	QuoteMint   string `output:"QuoteMint"`
+}
+
+type poolEventRecord struct {
+	BaseChange  int64  `output:"BaseChange"`
+	QuoteChange int64  `output:"QuoteChange"`
+	Program     string `output:"Program"`
+	BaseMint    string `output:"BaseMint"`
+	QuoteMint   string `output:"QuoteMint"`
+	Pool        string `output:"Pool"`
+}
+
+type transactionRecord struct {
+	Slot          uint64 `output:"Slot"`
+	Signature     string `output:"Signature"`
+	Instructions  int    `output:"Instructions"`
+	Signers       int    `output:"Signers"`
+	Signer        string `output:"Signer"`
+	Status        bool   `output:"Status"`
+	SOLValue      string `output:"SOLValue"`
+	CULimit       uint32 `output:"CULimit"`
+	CUPrice       uint64 `output:"CUPrice"`
+	PriorityFee   uint64 `output:"PriorityFee"`
+	ComputeBudget bool   `output:"ComputeBudget"`
+}
+
+type transferRecord struct {
+	Slot             uint64 `output:"Slot"`
+	TxIndex          uint32 `output:"TxIndex"`
+	Sign             string `output:"Sign"`
+	Mint             string `output:"Mint"`
+	TransferKind     string `output:"TransferKind"`
+	Sender           string `output:"Sender"`
+	Receiver         string `output:"Receiver"`
+	Amount           uint64 `output:"Amount"`
+	InstructionIndex uint32 `output:"InstructionIndex"`
+}
+
+type balanceRecord struct {
+	Slot    uint64 `output:"Slot"`
+	TxIndex uint32 `output:"TxIndex"`
+	Sign    string `output:"Sign"`
+	Address string `output:"Address"`
+	Owner   string `output:"Owner"`
+	Mint    string `output:"Mint"`
+	Pre     uint64 `output:"Pre"`
+	Post    uint64 `output:"Post"`
+	// Post - Pre with an explicit sign, raw and in whole tokens; equal
+	// when the update has no currency.
+	Delta      string `output:"Delta"`
+	DeltaValue string `output:"DeltaValue"`
+}
+
+// consoleRecords are the record types checkRename validates output.rename
+// against.
+var consoleRecords = []reflect.Type{
+	reflect.TypeFor[swapRecord](),
+	reflect.TypeFor[firstTradeRecord](),
+	reflect.TypeFor[orderRecord](),
+	reflect.TypeFor[poolEventRecord](),
+	reflect.TypeFor[transactionRecord](),
+	reflect.TypeFor[transferRecord](),
+	reflect.TypeFor[balanceRecord](),
+	reflect.TypeFor[programLogRecord](),
+	reflect.TypeFor[washTradeRecord](),
+	reflect.TypeFor[priceAlert](),
+	reflect.TypeFor[heartbeat](),
+}
+
+// checkRename validates output.rename: every key must be printed by some
+// record or be a field of the messages of streamTypes, and no record or
+// message may end up with two fields under the same key.
+func checkRename(rename map[string]string, streamTypes []string) error {
+	known := make(map[string]bool)
+	for _, t := range consoleRecords {
+		names := make([]string, 0, t.NumField())
+		for _, f := range recordFields(t) {
+			names = append(names, f.name)
+		}
+		if err := checkRenamed(rename, known, names, t.Name()); err != nil {
+			return err
+		}
+	}
+	visited := make(map[protoreflect.FullName]bool)
+	var checkMessage func(md protoreflect.MessageDescriptor) error
+	checkMessage = func(md protoreflect.MessageDescriptor) error {
+		if visited[md.FullName()] {
+			return nil
+		}
+		visited[md.FullName()] = true
+		fields := md.Fields()
+		names := make([]string, 0, fields.Len())
+		for i := 0; i < fields.Len(); i++ {
+			names = append(names, string(fields.Get(i).Name()))
+		}
+		if err := checkRenamed(rename, known, names, string(md.FullName())); err != nil {
+			return err
+		}
+		for i := 0; i < fields.Len(); i++ {
+			if sub := fields.Get(i).Message(); sub != nil {
+				if err := checkMessage(sub); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, streamType := range streamTypes {
+		md, err := streamDescriptor(streamType)
+		if err != nil {
+			return err
+		}
+		if err := checkMessage(md); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(rename))
+	for key := range rename {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if !known[key] {
+			return fmt.Errorf("output.rename: no record or message prints a %q key", key)
+		}
+		if rename[key] == "" {
+			return fmt.Errorf("output.rename: %s is renamed to an empty key; use \"-\" to drop it", key)
+		}
+	}
+	return nil
+}
+
+// checkRenamed marks the keys of one record or message as known, and
+// reports two of them ending up under the same key once renamed.
+func checkRenamed(rename map[string]string, known map[string]bool, keys []string, in string) error {
+	seen := make(map[string]string, len(keys)) // printed key -> original key
+	for _, key := range keys {
+		known[key] = true
+		name := key
+		if to, ok := rename[key]; ok {
+			if to == "-" {
+				continue
+			}
+			name = to
+		}
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("output.rename: %s and %s would both print as %q in %s", other, key, name, in)
+		}
+		seen[name] = key
+	}
+	return nil
+}
+
+// programLogRecord is one program log line of a transaction, or the count
+// of lines beyond program_logs.max_lines.
+type programLogRecord struct {
+	Signature string `output:"Signature"`
+	Line      string `output:"Line,omitempty"`
+	Omitted   int    `output:"Omitted,omitempty"`
+}
+
+type recordField struct {
+	index     []int
+	name      string
+	omitEmpty bool
+}
+
+var recordFieldCache sync.Map // reflect.Type -> []recordField
+
+// recordFields parses the `output` tags of a record struct once per type.
+// Untagged fields are printed under their Go name, and the fields of an
+// embedded record are printed in place.
+func recordFields(t reflect.Type) []recordField {
+	if cached, ok := recordFieldCache.Load(t); ok {
+		return cached.([]recordField)
+	}
+	var fields []recordField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("output") == "" {
+			for _, f := range recordFields(sf.Type) {
+				fields = append(fields, recordField{index: append([]int{i}, f.index...), name: f.name, omitEmpty: f.omitEmpty})
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(sf.Tag.Get("output"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, recordField{index: []int{i}, name: name, omitEmpty: opts == "omitempty"})
+	}
+	recordFieldCache.Store(t, fields)
+	return fields
+}
+
+// project flattens a record struct into log key/value pairs in field order,
+// applying output.rename: a renamed key is printed under its new name and a
+// key renamed to "-" is dropped.
+func project(rec any, rename map[string]string) []interface{} {
+	v := reflect.Indirect(reflect.ValueOf(rec))
+	fields := recordFields(v.Type())
+	ctx := make([]interface{}, 0, 2*len(fields))
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		name := f.name
+		if to, ok := rename[name]; ok {
+			if to == "-" {
+				continue
+			}
+			name = to
+		}
+		ctx = append(ctx, name, fv.Interface())
+	}
+	return ctx
+}
+
+// logRecord prints rec as one console line.
+func (c *consumer) logRecord(msg string, rec any) {
+	if c.blocks != nil {
+		event, err := c.recordJSON(msg, rec)
+		if err != nil {
+			log.Error("block record", "err", err)
+			return
+		}
+		c.addEvent(event)
+		return
+	}
+	log.Info(msg, project(rec, c.cfg.Output.Rename)...)
+}
+
+// emitRecord hands a record raised by the client itself, such as an
+// analyzer finding, to the sinks like the stream's messages: the console
+// prints it as a line named name, protojson as a {"<name>":{...}} line.
+func (c *consumer) emitRecord(stream, name string, fields any) {
+	c.emit(stream, clientRecord(name, fields))
+}
+
+// writeConsole is the sink of output.format: log. The full sample of the
+// message, if due, redacts it in place, so it has to be the last sink.
+func (c *consumer) writeConsole(stream string, rec record) error {
+	if rec.msg != nil {
+		c.sample(stream, rec.slot, rec.msg)
+	}
+	for _, r := range rec.console() {
+		c.logRecord(r.name, r.fields)
+	}
+	return nil
+}
+
+// writeClientRecord writes a record of the client's own in protojson mode,
+// as a {"<name>":{...}} line with its record keys, renamed and redacted like
+// the messages.
+func (c *consumer) writeClientRecord(r consoleRecord) error {
+	ctx := project(r.fields, c.cfg.Output.Rename)
+	if c.redact != nil {
+		c.redact.pairs(ctx)
+	}
+	obj := make(map[string]any, len(ctx)/2)
+	for i := 0; i+1 < len(ctx); i += 2 {
+		obj[fmt.Sprint(ctx[i])] = ctx[i+1]
+	}
+	b, err := json.Marshal(map[string]any{r.name: obj})
+	if err != nil {
+		return fmt.Errorf("%s record: %w", r.name, err)
+	}
+	return c.json.writeLine(b)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+
+	"corecast-client-example/internal"
+)
+
+func TestCheckRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		rename  map[string]string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"rename", map[string]string{"Sign": "Signature", "InstructionIndex": "-"}, false},
+		// Signature and Sign never share a record.
+		{"same target across records", map[string]string{"Sign": "Sig", "Signature": "Sig"}, false},
+		{"unknown key", map[string]string{"Signatur": "Sig"}, true},
+		{"empty target", map[string]string{"Sign": ""}, true},
+		{"two keys to one name", map[string]string{"Sender": "Party", "Receiver": "Party"}, true},
+		{"onto an existing key", map[string]string{"Sign": "Slot"}, true},
+		{"existing key moved away", map[string]string{"Sign": "Slot", "Slot": "BlockSlot"}, false},
+		// Keys of the messages, for protojson and Kafka.
+		{"message field", map[string]string{"MintAddress": "mint", "Signature": "txhash"}, false},
+		{"message fields collide", map[string]string{"PreBalance": "PostBalance"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRename(tt.rename, slices.Collect(maps.Keys(streamMethods))); (err != nil) != tt.wantErr {
+				t.Errorf("checkRename(%v) = %v, want error %v", tt.rename, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenameJSON(t *testing.T) {
+	rename := map[string]string{"Signature": "txhash", "Slot": "-"}
+	got, err := renameJSON([]byte(`{"Block":{"Slot":"9","Hash":"h"},"Transaction":{"Signature":"s","Signers":["a","b"]},"Signature":[{"Signature":1}]}`), rename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every depth is renamed, the field order kept and Slot dropped.
+	if want := `{"Block":{"Hash":"h"},"Transaction":{"txhash":"s","Signers":["a","b"]},"txhash":[{"txhash":1}]}`; string(got) != want {
+		t.Errorf("renamed:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestProtoJSONRename(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &internal.Config{}
+	cfg.Output.Rename = map[string]string{"Signature": "txhash", "Trader": "wallet"}
+	c := newTestConsumer(cfg, "dex_trades")
+	c.json = &protoJSONWriter{out: &out, rename: cfg.Output.Rename}
+	c.sinks = []sink{sinkFunc(c.writeJSON)}
+
+	c.emit("dex_trades", record{slot: 1, msg: &proto.DexTradeEventMessage{Transaction: &proto.TransactionInfo{Signature: []byte{1}}}})
+	c.emitRecord("dex_trades", "WashTradeSuspect", washTradeRecord{Trader: "T", Signature: "S"})
+	dec := json.NewDecoder(&out)
+	var msg struct{ Transaction map[string]any }
+	var rec struct{ WashTradeSuspect map[string]any }
+	if err := dec.Decode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := msg.Transaction["txhash"]; !ok {
+		t.Errorf("message keys %v, want Signature renamed to txhash", msg.Transaction)
+	}
+	if rec.WashTradeSuspect["wallet"] != "T" || rec.WashTradeSuspect["txhash"] != "S" {
+		t.Errorf("record keys %v, want Trader and Signature renamed", rec.WashTradeSuspect)
+	}
+}
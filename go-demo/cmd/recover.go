@@ -0,0 +1,88 @@
+package main
+
+import (
+	"runtime/debug"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+	"google.golang.org/grpc"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// recordingStream remembers the last message received, so that a panic
+// while processing it can name it.
+type recordingStream[T any] struct {
+	grpc.ServerStreamingClient[T]
+	last *T
+}
+
+func (s *recordingStream[T]) Recv() (*T, error) {
+	m, err := s.ServerStreamingClient.Recv()
+	if err == nil {
+		s.last = m
+	}
+	return m, err
+}
+
+// recoverConsume runs consume on strm. Unless stream.recover_panics is
+// false, a panic while processing a message, e.g. a nil dereference on a
+// message missing a field the code relies on, is logged with the message's
+// slot and signature and counted, and consume resumes with the next message
+// instead of crashing the process.
+func recoverConsume[T any](c *consumer, stream string, strm grpc.ServerStreamingClient[T], consume func(grpc.ServerStreamingClient[T]) error) error {
+	if rp := c.cfg.Stream.RecoverPanics; rp != nil && !*rp {
+		return consume(strm)
+	}
+	rs := &recordingStream[T]{ServerStreamingClient: strm}
+	for {
+		err, panicked := consumeOnce(c, stream, rs, consume)
+		if !panicked {
+			return err
+		}
+	}
+}
+
+func consumeOnce[T any](c *consumer, stream string, rs *recordingStream[T], consume func(grpc.ServerStreamingClient[T]) error) (err error, panicked bool) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		panicked = true
+		c.stats.panicked(stream)
+		var slot uint64
+		var sig string
+		if msg, ok := any(rs.last).(protobuf.Message); ok && rs.last != nil {
+			slot, sig = messageID(msg.ProtoReflect())
+		}
+		log.Error("panic processing message, skipped", "stream", stream, "slot", slot, "signature", sig, "panic", r)
+		log.Debug("panic stack", "stream", stream, "stack", string(debug.Stack()))
+	}()
+	return consume(rs), false
+}
+
+// messageID returns Block.Slot and Transaction.Signature of a stream
+// message, zero when unset.
+func messageID(m protoreflect.Message) (slot uint64, sig string) {
+	if v, ok := field(m, "Block"); ok {
+		if s, ok := field(v.Message(), "Slot"); ok {
+			slot = s.Uint()
+		}
+	}
+	if v, ok := field(m, "Transaction"); ok {
+		if s, ok := field(v.Message(), "Signature"); ok {
+			sig = base58.Encode(s.Bytes())
+		}
+	}
+	return slot, sig
+}
+
+// field returns the named field of m if m has it set.
+func field(m protoreflect.Message, name protoreflect.Name) (protoreflect.Value, bool) {
+	fd := m.Descriptor().Fields().ByName(name)
+	if fd == nil || !m.Has(fd) {
+		return protoreflect.Value{}, false
+	}
+	return m.Get(fd), true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	redactHash  = "hash"
+	redactBlank = "blank"
+)
+
+// redactor hashes or blanks selected fields in every output, matching log
+// keys and proto field names alike, in any case. A hash is the salted
+// SHA-256 of the value as printed on the console (base58 for addresses),
+// written as standard base64: the form protojson, and so Kafka, gives the
+// digest stored in a bytes field. The same address thus reads the same in
+// every output and can still be joined on.
+type redactor struct {
+	salt   string
+	fields map[string]string // lowercased field name -> redactHash | redactBlank
+	rename map[string]string // output.rename: message fields match under their new name
+}
+
+func newRedactor(salt string, fields map[string]string) (*redactor, error) {
+	r := &redactor{salt: salt, fields: make(map[string]string, len(fields))}
+	for name, action := range fields {
+		if action != redactHash && action != redactBlank {
+			return nil, fmt.Errorf("output.redact.fields.%s: unknown action %q (want hash or blank)", name, action)
+		}
+		key := strings.ToLower(name)
+		if prev, ok := r.fields[key]; ok && prev != action {
+			return nil, fmt.Errorf("output.redact.fields: %s is listed twice, in different case, with different actions", name)
+		}
+		r.fields[key] = action
+	}
+	return r, nil
+}
+
+// action returns what to do with the field or log key name, "" for nothing.
+func (r *redactor) action(name string) string {
+	return r.fields[strings.ToLower(name)]
+}
+
+// digest is the salted hash of a value in its console form.
+func (r *redactor) digest(s string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(r.salt + s))
+}
+
+func (r *redactor) hash(s string) string {
+	sum := r.digest(s)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// handler wraps next so that redacted keys never reach the log output.
+func (r *redactor) handler(next log.Handler) log.Handler {
+	return log.FuncHandler(func(rec *log.Record) error {
+		ctx := make([]interface{}, len(rec.Ctx))
+		copy(ctx, rec.Ctx)
+		r.pairs(ctx)
+		rec.Ctx = ctx
+		return next.Log(rec)
+	})
+}
+
+// pairs redacts the values of a log15 key/value list in place.
+func (r *redactor) pairs(ctx []interface{}) {
+	for i := 0; i+1 < len(ctx); i += 2 {
+		key, ok := ctx[i].(string)
+		if !ok {
+			continue
+		}
+		switch r.action(key) {
+		case redactHash:
+			ctx[i+1] = r.hash(fmt.Sprint(ctx[i+1]))
+		case redactBlank:
+			ctx[i+1] = ""
+		}
+	}
+}
+
+// message redacts m in place, descending into nested and repeated messages.
+// Only string and bytes fields can be hashed; other kinds are cleared.
+func (r *redactor) message(m protoreflect.Message) {
+	type hit struct {
+		fd     protoreflect.FieldDescriptor
+		action string
+	}
+	var hits []hit
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		if to, ok := r.rename[name]; ok && to != "-" {
+			name = to
+		}
+		if action := r.action(name); action != "" {
+			hits = append(hits, hit{fd, action})
+			return true
+		}
+		switch {
+		case fd.Message() == nil || fd.IsMap():
+		case fd.IsList():
+			for i, l := 0, v.List(); i < l.Len(); i++ {
+				r.message(l.Get(i).Message())
+			}
+		default:
+			r.message(v.Message())
+		}
+		return true
+	})
+
+	for _, h := range hits {
+		if h.action == redactBlank || (h.fd.Kind() != protoreflect.StringKind && h.fd.Kind() != protoreflect.BytesKind) {
+			m.Clear(h.fd)
+			continue
+		}
+		if h.fd.IsList() {
+			l := m.Mutable(h.fd).List()
+			for i := 0; i < l.Len(); i++ {
+				l.Set(i, r.hashValue(h.fd, l.Get(i)))
+			}
+			continue
+		}
+		m.Set(h.fd, r.hashValue(h.fd, m.Get(h.fd)))
+	}
+}
+
+func (r *redactor) hashValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) protoreflect.Value {
+	if fd.Kind() == protoreflect.StringKind {
+		return protoreflect.ValueOfString(r.hash(v.String()))
+	}
+	// Stored as the raw digest, which protojson prints as r.hash would.
+	sum := r.digest(base58.Encode(v.Bytes()))
+	return protoreflect.ValueOfBytes(sum[:])
+}
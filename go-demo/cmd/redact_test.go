@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	"github.com/mr-tron/base58"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestRedactSameHashEverywhere(t *testing.T) {
+	// Field names in a different case from both the log keys and the
+	// proto fields.
+	r, err := newRedactor("salt", map[string]string{"signature": redactHash, "SLOT": redactBlank})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := []byte{1, 2, 3, 4}
+
+	// Console: the log key, with the value in base58.
+	ctx := []any{"Signature", base58.Encode(sig), "Slot", uint64(7)}
+	r.pairs(ctx)
+	console := ctx[1].(string)
+	if ctx[3] != "" {
+		t.Errorf("Slot = %v, want blanked", ctx[3])
+	}
+
+	// protojson (and Kafka): the proto bytes field.
+	msg := &proto.DexTradeEventMessage{Block: &proto.Block{Slot: 7}, Transaction: &proto.TransactionInfo{Signature: sig}}
+	r.message(msg.ProtoReflect())
+	if msg.GetBlock().GetSlot() != 0 {
+		t.Errorf("Block.Slot = %d, want cleared", msg.GetBlock().GetSlot())
+	}
+	out, err := protojson.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"`+console+`"`) {
+		t.Errorf("protojson %s doesn't carry the console hash %s", out, console)
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	if _, err := newRedactor("", map[string]string{"Owner": redactHash, "owner": redactBlank}); err == nil {
+		t.Error("conflicting actions for one field in different case were accepted")
+	}
+	if _, err := newRedactor("", map[string]string{"Owner": redactHash, "OWNER": redactHash}); err != nil {
+		t.Errorf("the same action in different case was rejected: %v", err)
+	}
+	if _, err := newRedactor("", map[string]string{"Owner": "drop"}); err == nil {
+		t.Error("an unknown action was accepted")
+	}
+}
+
+func TestRedactRenamedField(t *testing.T) {
+	r, err := newRedactor("", map[string]string{"txhash": redactBlank})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.rename = map[string]string{"Signature": "txhash"}
+	msg := &proto.DexTradeEventMessage{Transaction: &proto.TransactionInfo{Signature: []byte{1}}}
+	r.message(msg.ProtoReflect())
+	if sig := msg.GetTransaction().GetSignature(); sig != nil {
+		t.Errorf("Signature = %x, want blanked under its new name txhash", sig)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// fullSampler logs the complete protojson of one message per interval, so
+// the structure of real messages can be spot-checked in production logs
+// while every other message keeps its compact one-line form.
+type fullSampler struct {
+	interval time.Duration
+	mu       sync.Mutex // shared by the consumers of all stream types
+	last     time.Time
+}
+
+// sample dumps msg if the interval has passed since the previous dump. The
+// first message of a run is always dumped.
+func (c *consumer) sample(stream string, slot uint64, msg protobuf.Message) {
+	s := c.sampler
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	due := time.Since(s.last) >= s.interval
+	if due {
+		s.last = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	if c.redact != nil {
+		c.redact.message(msg.ProtoReflect())
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		log.Error("full sample", "err", err)
+		return
+	}
+	log.Info("FullSample (sampled full message dump)", "Stream", stream, "Slot", slot, "Every", s.interval, "Message", string(b))
+}
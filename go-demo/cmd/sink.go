@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// sink is an output that takes every record the consumers produce: Kafka,
+// and the writer of output.format, i.e. the console (writeConsole), csv
+// (writeCSV) or protojson (writeJSON) one. main picks them from the config;
+// the consumers only call emit. A sink that also implements io.Closer is
+// closed by closeSinks.
+type sink interface {
+	handle(stream string, rec record) error
+}
+
+// sinkFunc adapts a function to the sink interface.
+type sinkFunc func(stream string, rec record) error
+
+func (f sinkFunc) handle(stream string, rec record) error {
+	return f(stream, rec)
+}
+
+// record is what the sinks are handed: a message that passed the filters,
+// as the server sent it, together with the console records the consumer
+// derives from it and its own state, such as first trades or resolved
+// account owners. Records raised by the client itself, such as analyzer
+// findings and heartbeats, have no message.
+type record struct {
+	slot uint64
+	msg  protobuf.Message // nil for the client's own records
+	hash string           // RecordHash of msg, set by emit with output.record_hash
+	// console builds the console records. Only the console and csv sinks
+	// call it, so the other outputs don't pay for encoding the fields.
+	console func() []consoleRecord
+}
+
+// consoleRecord is one console line: its message and a record struct whose
+// `output` tags give the keys, see project.
+type consoleRecord struct {
+	name   string
+	fields any
+}
+
+// clientRecord returns the record of a line raised by the client itself.
+func clientRecord(name string, fields any) record {
+	return record{console: func() []consoleRecord { return []consoleRecord{{name, fields}} }}
+}
+
+// recordKey is the routing key of a sink that partitions its records, such
+// as Kafka's message key: a dotted path to a scalar field of the message,
+// e.g. Transaction.Signature or Trade.Buy.Currency.MintAddress.
+type recordKey []protoreflect.Name
+
+// newRecordKey parses path and checks that it names a singular scalar field
+// in the messages of every stream type, so a typo fails at startup. option
+// is the setting path comes from, for the errors. An empty path is no key.
+func newRecordKey(option, path string, streamTypes []string) (recordKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	var key recordKey
+	for _, name := range strings.Split(path, ".") {
+		key = append(key, protoreflect.Name(name))
+	}
+	for _, streamType := range streamTypes {
+		desc, err := streamDescriptor(streamType)
+		if err != nil {
+			return nil, err
+		}
+		if err := key.check(desc); err != nil {
+			return nil, fmt.Errorf("%s %q for %s: %w", option, path, streamType, err)
+		}
+	}
+	return key, nil
+}
+
+// check verifies that k names a singular scalar field of desc.
+func (k recordKey) check(desc protoreflect.MessageDescriptor) error {
+	for i, name := range k {
+		fd := desc.Fields().ByName(name)
+		switch {
+		case fd == nil:
+			return fmt.Errorf("no field %s in %s", name, desc.FullName())
+		case fd.IsList() || fd.IsMap():
+			return fmt.Errorf("%s is repeated", name)
+		case i < len(k)-1:
+			if fd.Message() == nil {
+				return fmt.Errorf("%s is not a message", name)
+			}
+			desc = fd.Message()
+		case fd.Message() != nil:
+			return fmt.Errorf("%s is a message, not a scalar field", name)
+		}
+	}
+	return nil
+}
+
+// of returns the key field of m, base58 encoded for bytes fields (i.e.
+// signatures and addresses), or nil for no key or when the field or its
+// parent is unset.
+func (k recordKey) of(m protoreflect.Message) []byte {
+	if k == nil {
+		return nil
+	}
+	for _, name := range k[:len(k)-1] {
+		fd := m.Descriptor().Fields().ByName(name)
+		if !m.Has(fd) {
+			return nil
+		}
+		m = m.Get(fd).Message()
+	}
+	fd := m.Descriptor().Fields().ByName(k[len(k)-1])
+	if !m.Has(fd) {
+		return nil
+	}
+	v := m.Get(fd)
+	if fd.Kind() == protoreflect.BytesKind {
+		return []byte(base58.Encode(v.Bytes()))
+	}
+	return []byte(v.String())
+}
+
+// emit hands rec to every sink in order. A sink failing doesn't keep rec
+// from the others; the failure is logged and counted per stream.
+func (c *consumer) emit(stream string, rec record) {
+	if c.cfg.Output.RecordHash && rec.msg != nil {
+		var err error
+		if rec.hash, err = recordHash(rec.msg); err != nil {
+			log.Error("record hash", "stream", stream, "err", err)
+		}
+	}
+	for _, s := range c.sinks {
+		if err := s.handle(stream, rec); err != nil {
+			c.stats.outputError(stream)
+			log.Error("output", "stream", stream, "err", err)
+		}
+	}
+}
+
+// closeSinks closes the sinks that implement io.Closer once the streams have
+// stopped, in the reverse order of registration like deferred calls, so a
+// sink added on top of another is flushed first. Every sink is closed even
+// if one fails; the first error is returned.
+func (c *consumer) closeSinks() error {
+	var first error
+	for i := len(c.sinks) - 1; i >= 0; i-- {
+		cl, ok := c.sinks[i].(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := cl.Close(); err != nil {
+			log.Error("output close", "err", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// recordHash returns the RecordHash of a message (output.record_hash): the
+// SHA-256, in hex, of its deterministic protobuf encoding as received, i.e.
+// before output.fields, redaction and renaming apply, so the same event
+// gets the same hash whichever connection delivered it.
+func recordHash(msg protobuf.Message) (string, error) {
+	b, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// withRecordHash adds hash as the last key, RecordHash, of the JSON object
+// b; an empty hash leaves b as is.
+func withRecordHash(b []byte, hash string) []byte {
+	end := bytes.LastIndexByte(b, '}')
+	if hash == "" || end < 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b)+len(hash)+16)
+	out = append(out, b[:end]...)
+	if len(bytes.TrimSpace(b[1:end])) > 0 {
+		out = append(out, ',')
+	}
+	out = append(out, `"RecordHash":"`...)
+	out = append(out, hash...)
+	out = append(out, `"}`...)
+	return out
+}
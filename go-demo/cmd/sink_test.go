@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	solana_messages "github.com/bitquery/streaming_protobuf/v2/solana/messages"
+	"github.com/mr-tron/base58"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"corecast-client-example/internal"
+)
+
+// fakeSink records the streams of the records it is handed and the order
+// sinks are closed in.
+type fakeSink struct {
+	name    string
+	err     error // returned by handle
+	handled []string
+	closed  *[]string
+}
+
+func (s *fakeSink) handle(stream string, _ record) error {
+	s.handled = append(s.handled, stream)
+	return s.err
+}
+
+func (s *fakeSink) Close() error {
+	*s.closed = append(*s.closed, s.name)
+	return s.err
+}
+
+func TestEmit(t *testing.T) {
+	var closed []string
+	failing := &fakeSink{name: "failing", err: errors.New("broken pipe"), closed: &closed}
+	ok := &fakeSink{name: "ok", closed: &closed}
+	c := newTestConsumer(&internal.Config{}, "dex_trades")
+	c.sinks = []sink{failing, ok}
+
+	rec := record{msg: &proto.DexTradeEventMessage{}}
+	c.emit("dex_trades", rec)
+	c.emit("dex_trades", rec)
+
+	// Fan-out: every sink gets every message, including after a failure.
+	for _, s := range []*fakeSink{failing, ok} {
+		if !slices.Equal(s.handled, []string{"dex_trades", "dex_trades"}) {
+			t.Errorf("sink %s handled %v, want two dex_trades messages", s.name, s.handled)
+		}
+	}
+	if n := c.stats.snapshot().Streams["dex_trades"].OutputErrors; n != 2 {
+		t.Errorf("output errors = %d, want 2", n)
+	}
+}
+
+// TestConsumeThroughSinks checks that a consumer hands each message, with its
+// console records, to every sink.
+func TestConsumeThroughSinks(t *testing.T) {
+	var names []string
+	console := sinkFunc(func(_ string, rec record) error {
+		for _, r := range rec.console() {
+			names = append(names, r.name)
+		}
+		return nil
+	})
+	var msgs []protobuf.Message
+	raw := sinkFunc(func(_ string, rec record) error {
+		msgs = append(msgs, rec.msg)
+		return nil
+	})
+
+	tx := &proto.TransactionInfo{Signature: []byte{1}}
+	trade := &proto.DexTradeEventMessage{Block: &proto.Block{Slot: 1}, Transaction: tx, Trade: &solana_messages.DexTradeEvent{Buy: &solana_messages.TradeSide{Amount: 1}}}
+
+	c := newTestConsumer(&internal.Config{}, "dex_trades")
+	c.sinks = []sink{raw, console}
+	consumeAll(t, c.consumeDexTrades, trade)
+	if len(msgs) != 1 || msgs[0] != trade {
+		t.Errorf("raw sink got %v, want the trade", msgs)
+	}
+	if !slices.Equal(names, []string{"Swap"}) {
+		t.Errorf("console sink got %v, want one Swap record", names)
+	}
+
+}
+
+func TestCloseSinks(t *testing.T) {
+	var closed []string
+	c := newTestConsumer(&internal.Config{}, "dex_trades")
+	first := &fakeSink{name: "first", closed: &closed}
+	failing := &fakeSink{name: "failing", err: errors.New("flush failed"), closed: &closed}
+	last := &fakeSink{name: "last", closed: &closed}
+	noCloser := sinkFunc(func(string, record) error { return nil })
+	c.sinks = []sink{first, failing, noCloser, last}
+
+	err := c.closeSinks()
+	if err == nil || err.Error() != "flush failed" {
+		t.Errorf("closeSinks = %v, want the failing sink's error", err)
+	}
+	if want := []string{"last", "failing", "first"}; !slices.Equal(closed, want) {
+		t.Errorf("closed in order %v, want %v", closed, want)
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	streams := []string{"dex_trades", "transfers", "balances"}
+	for _, tt := range []struct {
+		path    string
+		wantErr string
+	}{
+		{"", ""},
+		{"Transaction.Signature", ""},
+		{"Block.Slot", ""},
+		{"Transaction.Sig", "no field Sig"},
+		{"Transaction", "is a message"},
+		{"Block.Slot.Value", "is not a message"},
+	} {
+		_, err := newRecordKey("output.kafka.key_field", tt.path, streams)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%q: %v", tt.path, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%q: error %v, want one containing %q", tt.path, err, tt.wantErr)
+		}
+	}
+	if _, err := newRecordKey("output.kafka.key_field", "Trade.InstructionIndex", streams); err == nil || !strings.Contains(err.Error(), "for transfers") {
+		t.Errorf("a field of dex_trades only passed for transfers: %v", err)
+	}
+
+	key, err := newRecordKey("output.kafka.key_field", "Transaction.Signature", streams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &proto.DexTradeEventMessage{Transaction: &proto.TransactionInfo{Signature: []byte{1, 2, 3}}}
+	if got := string(key.of(msg.ProtoReflect())); got != base58.Encode([]byte{1, 2, 3}) {
+		t.Errorf("key = %q, want the base58 signature", got)
+	}
+	if got := key.of((&proto.DexTradeEventMessage{}).ProtoReflect()); got != nil {
+		t.Errorf("key of a message without Transaction = %q, want nil", got)
+	}
+	// The default key is valid for every stream type.
+	if _, err := newRecordKey("output.kafka.key_field", "Transaction.Signature", slices.Collect(maps.Keys(streamMethods))); err != nil {
+		t.Errorf("default key: %v", err)
+	}
+	slot, _ := newRecordKey("output.kafka.key_field", "Block.Slot", streams)
+	if got := string(slot.of((&proto.DexTradeEventMessage{Block: &proto.Block{Slot: 42}}).ProtoReflect())); got != "42" {
+		t.Errorf("slot key = %q, want 42", got)
+	}
+}
+
+func TestRecordHash(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &internal.Config{}
+	cfg.Output.RecordHash = true
+	cfg.Output.Rename = map[string]string{"Signature": "txhash"}
+	c := newTestConsumer(cfg, "dex_trades")
+	c.json = &protoJSONWriter{out: &out, rename: cfg.Output.Rename}
+	c.sinks = []sink{sinkFunc(c.writeJSON)}
+
+	msg := &proto.DexTradeEventMessage{Block: &proto.Block{Slot: 7}, Transaction: &proto.TransactionInfo{Signature: []byte{1, 2}}}
+	want, err := recordHash(protobuf.Clone(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.emit("dex_trades", record{slot: 7, msg: msg})
+	var line map[string]any
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("%q: %v", out.String(), err)
+	}
+	// The hash is of the message as received, not of the renamed JSON.
+	if line["RecordHash"] != want || len(want) != 64 {
+		t.Errorf("RecordHash = %v, want %s", line["RecordHash"], want)
+	}
+
+	for in, want := range map[string]string{
+		`{"a":1}`:  `{"a":1,"RecordHash":"h"}`,
+		`{ }`:      `{ "RecordHash":"h"}`,
+		`{"a":1 }`: `{"a":1 ,"RecordHash":"h"}`,
+	} {
+		if got := string(withRecordHash([]byte(in), "h")); got != want {
+			t.Errorf("withRecordHash(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
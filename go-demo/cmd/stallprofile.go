@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// stallProfiler captures profiles once per stall, i.e. when no message
+// arrived on the stream for the configured time, to show whether the client
+// is stuck decoding, blocked on its output or just waiting on the network.
+// A paused stream is not stalled.
+type stallProfiler struct {
+	stats  *stats
+	pause  *pauser
+	stream string
+	dir    string
+	after  time.Duration
+	cpu    time.Duration
+}
+
+func (p *stallProfiler) run(ctx context.Context) {
+	start := time.Now()
+	ticker := time.NewTicker(p.after / 4)
+	defer ticker.Stop()
+
+	var captured time.Time // LastMessage of the stall already profiled
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			last := p.stats.snapshot().Streams[p.stream].LastMessage
+			if last.IsZero() {
+				last = start
+			}
+			last, running := p.pause.idleSince(p.stream, last)
+			if !running || now.Sub(last) < p.after || last.Equal(captured) {
+				continue
+			}
+			captured = last
+			log.Warn("stream stalled, capturing profiles", "stream", p.stream, "since", last.Format(time.RFC3339), "dir", p.dir)
+			if err := p.capture(ctx, now); err != nil {
+				log.Error("stall profile", "err", err)
+			}
+		}
+	}
+}
+
+// capture writes the stacks of all goroutines right away, then profiles the
+// CPU for p.cpu. Files are named after the stall time, so repeated stalls
+// don't overwrite each other.
+func (p *stallProfiler) capture(ctx context.Context, at time.Time) error {
+	prefix := filepath.Join(p.dir, "stall-"+at.UTC().Format("20060102T150405Z"))
+
+	g, err := os.Create(prefix + "-goroutine.txt")
+	if err != nil {
+		return err
+	}
+	err = pprof.Lookup("goroutine").WriteTo(g, 2)
+	if cerr := g.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("goroutine profile: %w", err)
+	}
+
+	if p.cpu <= 0 {
+		return nil
+	}
+	f, err := os.Create(prefix + "-cpu.pprof")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return fmt.Errorf("cpu profile: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(p.cpu):
+	}
+	pprof.StopCPUProfile()
+	log.Info("stall profiles written", "goroutine", prefix+"-goroutine.txt", "cpu", f.Name())
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+// streamState is where a stream is in the reconnect loop, see resubscribe.
+type streamState int
+
+const (
+	stateConnecting   streamState = iota // subscribed, no message received yet
+	stateConnected                       // messages arriving
+	stateReconnecting                    // ended, re-subscribing until a message arrives
+	stateFailed                          // given up on, not subscribed again
+)
+
+var streamStates = []streamState{stateConnecting, stateConnected, stateReconnecting, stateFailed}
+
+func (s streamState) String() string {
+	return [...]string{"connecting", "connected", "reconnecting", "failed"}[s]
+}
+
+type streamStats struct {
+	State   streamState
+	Backoff time.Duration // delay before the next re-subscribe, while reconnecting
+
+	Messages     uint64
+	FirstSlot    uint64
+	LastSlot     uint64
+	LastSlotAt   time.Time // when LastSlot was first seen
+	LastMessage  time.Time
+	Reconnects   uint64
+	DecodeErrors uint64
+	RateLimited  uint64
+	StreamResets uint64           // streams reset by the server (RST_STREAM)
+	Panics       uint64           // messages skipped by stream.recover_panics
+	OutputErrors uint64           // sink writes that failed, see emit
+	Latency      latencyHistogram // sampled when stream.latency_interval is set
+}
+
+// maxTrackedTokens bounds the mints counted for topTokens. When it is
+// reached, the less frequent half is forgotten, so a long run over many
+// one-off mints keeps a fixed amount of memory while the frequent ones keep
+// their counts.
+const maxTrackedTokens = 2000
+
+type tokenCount struct {
+	Mint  string
+	Count uint64
+}
+
+// stats collects per-stream counters from the consumers. It is the single
+// source of the numbers shown by the dashboard.
+type stats struct {
+	mu      sync.Mutex
+	streams map[string]*streamStats
+	tokens  map[string]uint64 // raw mint bytes -> count, see maxTrackedTokens
+	errors  uint64
+	// oversize counts messages rejected for exceeding tuning.max_recv_msg_size.
+	oversized uint64
+	// withoutBlock counts messages skipped because they carried no Block.
+	withoutBlock uint64
+	// partial counts messages skipped because the event itself was missing.
+	partial uint64
+	// kafkaSent and kafkaFailed count messages acknowledged by or finally
+	// failed to reach Kafka.
+	kafkaSent   uint64
+	kafkaFailed uint64
+	// zeroAmounts counts messages dropped by filters.drop_zero_amount.
+	zeroAmounts uint64
+	// duplicates counts events dropped by dedup.window_size.
+	duplicates uint64
+}
+
+func newStats() *stats {
+	return &stats{
+		streams: make(map[string]*streamStats),
+		tokens:  make(map[string]uint64),
+	}
+}
+
+// message records one received message and the token mints it references.
+func (s *stats) message(stream string, slot uint64, mints ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stream(stream)
+	st.Messages++
+	st.State, st.Backoff = stateConnected, 0
+	st.LastMessage = time.Now()
+	if st.FirstSlot == 0 {
+		st.FirstSlot = slot
+	}
+	if slot > st.LastSlot {
+		st.LastSlot = slot
+		st.LastSlotAt = st.LastMessage
+	}
+	for _, m := range mints {
+		if len(m) == 0 {
+			continue
+		}
+		if _, ok := s.tokens[string(m)]; !ok && len(s.tokens) >= maxTrackedTokens {
+			s.pruneTokens()
+		}
+		s.tokens[string(m)]++
+	}
+}
+
+// pruneTokens keeps the maxTrackedTokens/2 most frequent mints. s.mu must
+// be held.
+func (s *stats) pruneTokens() {
+	all := make([]tokenCount, 0, len(s.tokens))
+	for mint, count := range s.tokens {
+		all = append(all, tokenCount{Mint: mint, Count: count})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Count > all[j].Count })
+	for _, t := range all[maxTrackedTokens/2:] {
+		delete(s.tokens, t.Mint)
+	}
+}
+
+// stream returns the counters of a stream, creating them on first use.
+// s.mu must be held.
+func (s *stats) stream(name string) *streamStats {
+	st, ok := s.streams[name]
+	if !ok {
+		st = &streamStats{}
+		s.streams[name] = st
+	}
+	return st
+}
+
+// setState records where stream is in the reconnect loop and, while
+// reconnecting, the delay before the next attempt.
+func (s *stats) setState(stream string, state streamState, backoff time.Duration) {
+	s.mu.Lock()
+	st := s.stream(stream)
+	st.State, st.Backoff = state, backoff
+	s.mu.Unlock()
+}
+
+func (s *stats) reconnect(stream string) {
+	s.mu.Lock()
+	s.stream(stream).Reconnects++
+	s.mu.Unlock()
+}
+
+func (s *stats) decodeError(stream string) {
+	s.mu.Lock()
+	s.stream(stream).DecodeErrors++
+	s.mu.Unlock()
+}
+
+func (s *stats) error() {
+	s.mu.Lock()
+	s.errors++
+	s.mu.Unlock()
+}
+
+func (s *stats) oversize() {
+	s.mu.Lock()
+	s.oversized++
+	s.mu.Unlock()
+}
+
+// blockless counts a message without a Block and returns the total so far.
+func (s *stats) blockless() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.withoutBlock++
+	return s.withoutBlock
+}
+
+// incomplete counts a message without its event and returns the total so far.
+func (s *stats) incomplete() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partial++
+	return s.partial
+}
+
+func (s *stats) kafkaResult(sent, failed uint64) {
+	s.mu.Lock()
+	s.kafkaSent += sent
+	s.kafkaFailed += failed
+	s.mu.Unlock()
+}
+
+func (s *stats) zeroAmount() {
+	s.mu.Lock()
+	s.zeroAmounts++
+	s.mu.Unlock()
+}
+
+func (s *stats) panicked(stream string) {
+	s.mu.Lock()
+	s.stream(stream).Panics++
+	s.mu.Unlock()
+}
+
+func (s *stats) outputError(stream string) {
+	s.mu.Lock()
+	s.stream(stream).OutputErrors++
+	s.mu.Unlock()
+}
+
+func (s *stats) rateLimited(stream string) {
+	s.mu.Lock()
+	s.stream(stream).RateLimited++
+	s.mu.Unlock()
+}
+
+func (s *stats) streamReset(stream string) {
+	s.mu.Lock()
+	s.stream(stream).StreamResets++
+	s.mu.Unlock()
+}
+
+func (s *stats) latency(stream string, d time.Duration) {
+	s.mu.Lock()
+	s.stream(stream).Latency.observe(d)
+	s.mu.Unlock()
+}
+
+func (s *stats) duplicate() {
+	s.mu.Lock()
+	s.duplicates++
+	s.mu.Unlock()
+}
+
+func (s *stats) lastSlot(stream string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.streams[stream]; ok {
+		return st.LastSlot
+	}
+	return 0
+}
+
+type statsSnapshot struct {
+	Streams     map[string]streamStats
+	Errors      uint64
+	Oversize    uint64
+	Blockless   uint64
+	Incomplete  uint64
+	ZeroAmount  uint64
+	Duplicates  uint64
+	KafkaSent   uint64
+	KafkaFailed uint64
+}
+
+func (s *stats) snapshot() statsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := statsSnapshot{Streams: make(map[string]streamStats, len(s.streams)), Errors: s.errors, Oversize: s.oversized, Blockless: s.withoutBlock, Incomplete: s.partial, ZeroAmount: s.zeroAmounts, Duplicates: s.duplicates, KafkaSent: s.kafkaSent, KafkaFailed: s.kafkaFailed}
+	for name, st := range s.streams {
+		snap.Streams[name] = *st
+	}
+	return snap
+}
+
+// topTokens returns the n most frequently seen mints.
+func (s *stats) topTokens(n int) []tokenCount {
+	s.mu.Lock()
+	top := make([]tokenCount, 0, len(s.tokens))
+	for mint, count := range s.tokens {
+		top = append(top, tokenCount{Mint: mint, Count: count})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool { return top[i].Count > top[j].Count })
+	if len(top) > n {
+		top = top[:n]
+	}
+	for i := range top {
+		top[i].Mint = base58.Encode([]byte(top[i].Mint))
+	}
+	return top
+}
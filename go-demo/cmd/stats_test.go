@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/mr-tron/base58"
+)
+
+func TestTopTokensBounded(t *testing.T) {
+	s := newStats()
+	frequent := []byte("frequent-mint")
+	for i := range 10 * maxTrackedTokens {
+		mint := binary.BigEndian.AppendUint64(nil, uint64(i))
+		s.message("transfers", 1, mint, frequent)
+	}
+	if n := len(s.tokens); n > maxTrackedTokens {
+		t.Errorf("%d mints tracked, want at most %d", n, maxTrackedTokens)
+	}
+	top := s.topTokens(1)
+	if len(top) != 1 || top[0].Mint != base58.Encode(frequent) || top[0].Count != 10*maxTrackedTokens {
+		t.Errorf("topTokens(1) = %+v, want %s x %d", top, base58.Encode(frequent), 10*maxTrackedTokens)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// recvClass is the kind of failure that ended a stream. It decides whether
+// the stream is subscribed again and how loudly the end is logged.
+type recvClass int
+
+const (
+	recvOther       recvClass = iota // anything else, retried only if its code is in reconnect.on_codes
+	recvEOF                          // the server closed the stream cleanly
+	recvCanceled                     // the client is shutting down
+	recvUnavailable                  // connection lost or server restarting
+	recvExhausted                    // ResourceExhausted for a message over the size limit
+	recvRateLimited                  // any other ResourceExhausted: the plan's rate limit or quota
+	recvAuth                         // Unauthenticated or PermissionDenied
+	recvRejected                     // InvalidArgument or Unimplemented: the request itself
+	recvIdle                         // ended by stream.idle_timeout, re-subscribed right away
+)
+
+var recvClassNames = map[recvClass]string{
+	recvOther:       "other",
+	recvEOF:         "eof",
+	recvCanceled:    "canceled",
+	recvUnavailable: "unavailable",
+	recvExhausted:   "resource_exhausted",
+	recvRateLimited: "rate_limited",
+	recvAuth:        "auth",
+	recvRejected:    "rejected",
+	recvIdle:        "idle",
+}
+
+func (c recvClass) String() string { return recvClassNames[c] }
+
+// recvError is the error a stream ended with, along with its class. It
+// unwraps to the original error, so status.Code and errors.Is still work.
+type recvError struct {
+	class   recvClass
+	err     error
+	trailer metadata.MD // the stream's trailer metadata, if it got that far
+}
+
+func (e *recvError) Error() string { return e.err.Error() }
+func (e *recvError) Unwrap() error { return e.err }
+
+// classifyRecv wraps the error a stream ended with in a recvError. nil and
+// already classified errors are returned as is.
+func classifyRecv(err error) error {
+	var re *recvError
+	if err == nil || errors.As(err, &re) {
+		return err
+	}
+	class := recvOther
+	switch {
+	case errors.Is(err, errIdle):
+		class = recvIdle
+	case errors.Is(err, io.EOF):
+		class = recvEOF
+	case errors.Is(err, context.Canceled):
+		class = recvCanceled
+	default:
+		switch status.Code(err) {
+		case codes.Canceled:
+			class = recvCanceled
+		case codes.Unavailable:
+			class = recvUnavailable
+		case codes.ResourceExhausted:
+			class = recvRateLimited
+			if isOversize(err) {
+				class = recvExhausted
+			}
+		case codes.Unauthenticated, codes.PermissionDenied:
+			class = recvAuth
+		case codes.InvalidArgument, codes.Unimplemented:
+			class = recvRejected
+		}
+	}
+	return &recvError{class: class, err: err}
+}
+
+// withTrailer classifies the error strm ended with and keeps the stream's
+// trailer metadata along with it, for hints such as retry-after.
+func withTrailer(strm grpc.ClientStream, err error) error {
+	err = classifyRecv(err)
+	var re *recvError
+	if errors.As(err, &re) {
+		re.trailer = strm.Trailer()
+	}
+	return err
+}
+
+// retryAfter returns the delay the server asked for before the next attempt,
+// from the retry-after trailer (seconds or a Go duration) or gRPC's
+// grpc-retry-pushback-ms, if present.
+func retryAfter(err error) (time.Duration, bool) {
+	var re *recvError
+	if !errors.As(err, &re) {
+		return 0, false
+	}
+	if v := re.trailer.Get("retry-after"); len(v) > 0 {
+		if secs, err := strconv.Atoi(v[0]); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if d, err := time.ParseDuration(v[0]); err == nil && d >= 0 {
+			return d, true
+		}
+	}
+	if v := re.trailer.Get("grpc-retry-pushback-ms"); len(v) > 0 {
+		if ms, err := strconv.Atoi(v[0]); err == nil && ms >= 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+	}
+	return 0, false
+}
+
+// recvClassOf returns the class of an error returned by classifyRecv.
+func recvClassOf(err error) recvClass {
+	var re *recvError
+	if errors.As(err, &re) {
+		return re.class
+	}
+	return recvOther
+}
+
+// isOversize reports whether err is grpc-go's ResourceExhausted error for a
+// received message larger than the MaxCallRecvMsgSize dial option.
+func isOversize(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.ResourceExhausted && strings.Contains(st.Message(), "larger than max")
+}
+
+// isDecodeError reports whether err is grpc-go failing to unmarshal a
+// received message, e.g. after a schema change on the server.
+func isDecodeError(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.Internal && strings.Contains(st.Message(), "failed to unmarshal")
+}
+
+// streamReset reports whether err comes from the server resetting this
+// stream (HTTP/2 RST_STREAM) rather than the connection failing, and
+// returns the HTTP/2 error code given as the reason.
+func streamReset(err error) (reason string, ok bool) {
+	st, isStatus := status.FromError(err)
+	if !isStatus {
+		return "", false
+	}
+	_, reason, ok = strings.Cut(st.Message(), "RST_STREAM with error code: ")
+	return reason, ok
+}
+
+// streamEnd logs why a consume loop stopped, at a level depending on the
+// class of err. Oversize messages are counted and reported with the
+// configured limit, so it is clear whether tuning.max_recv_msg_size needs to
+// be raised; server stream resets are counted and logged with their reason,
+// apart from connection failures. Messages that fail to decode are counted per stream.
+func (c *consumer) streamEnd(stream string, err error) {
+	if isDecodeError(err) {
+		c.stats.decodeError(stream)
+		log.Error("message decode failed", "stream", stream, "last_slot", c.stats.lastSlot(stream), "err", err)
+		return
+	}
+	if reason, ok := streamReset(err); ok {
+		c.stats.streamReset(stream)
+		log.Error("stream reset by server", "stream", stream, "reason", reason,
+			"last_slot", c.stats.lastSlot(stream), "code", status.Code(err))
+		return
+	}
+	if !isOversize(err) {
+		class := recvClassOf(err)
+		switch class {
+		case recvCanceled, recvIdle:
+			log.Debug("stream end", "stream", stream, "class", class, "err", err)
+		case recvEOF:
+			log.Info("stream closed by server", "stream", stream, "last_slot", c.stats.lastSlot(stream))
+		case recvAuth, recvRejected:
+			log.Error("stream rejected by server", "stream", stream, "class", class,
+				"code", status.Code(err), "err", err)
+		case recvRateLimited:
+			c.stats.rateLimited(stream)
+			ctx := []any{"stream", stream, "last_slot", c.stats.lastSlot(stream), "err", status.Convert(err).Message()}
+			if d, ok := retryAfter(err); ok {
+				ctx = append(ctx, "retry_after", d)
+			}
+			log.Warn("rate limited by server (ResourceExhausted), check your plan's limits", ctx...)
+		default:
+			log.Warn("stream end", "stream", stream, "class", class,
+				"code", status.Code(err), "last_slot", c.stats.lastSlot(stream), "err", err)
+		}
+		return
+	}
+	c.stats.oversize()
+	log.Error("message exceeds tuning.max_recv_msg_size",
+		"stream", stream,
+		"limit", c.cfg.Tuning.MaxRecvMsgSize,
+		"last_slot", c.stats.lastSlot(stream),
+		"oversize_total", c.stats.snapshot().Oversize,
+		"err", err,
+	)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"google.golang.org/grpc/metadata"
+
+	"corecast-client-example/internal"
+)
+
+// tokenProvider returns the authorization token to use for a connection.
+// It is called on every connect, so short-lived tokens can be rotated by
+// the provider without restarting the client.
+type tokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// envToken re-reads an environment variable, e.g. one refreshed by a wrapper.
+type envToken struct{ name string }
+
+func (t envToken) Token(context.Context) (string, error) {
+	v := os.Getenv(t.name)
+	if v == "" {
+		return "", fmt.Errorf("environment variable %s is empty", t.name)
+	}
+	return v, nil
+}
+
+// commandToken runs a command and uses its trimmed stdout as the token.
+type commandToken struct{ argv []string }
+
+func (t commandToken) Token(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, t.argv[0], t.argv[1:]...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", t.argv[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// httpToken GETs a URL. A JSON body with a "token" or "access_token" field
+// is unwrapped; any other body is used as the token as is.
+type httpToken struct {
+	url    string
+	client *http.Client
+}
+
+func (t httpToken) Token(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var wrapped struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if json.Unmarshal(body, &wrapped) == nil {
+		if wrapped.Token != "" {
+			return wrapped.Token, nil
+		}
+		if wrapped.AccessToken != "" {
+			return wrapped.AccessToken, nil
+		}
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func newTokenProvider(cfg *internal.Config) (tokenProvider, error) {
+	tp := cfg.Server.TokenProvider
+	switch tp.Type {
+	case "env":
+		if tp.Env == "" {
+			return nil, errors.New("server.token_provider.env is required for type env")
+		}
+		return envToken{name: tp.Env}, nil
+	case "command":
+		if len(tp.Command) == 0 {
+			return nil, errors.New("server.token_provider.command is required for type command")
+		}
+		return commandToken{argv: tp.Command}, nil
+	case "http":
+		if tp.URL == "" {
+			return nil, errors.New("server.token_provider.url is required for type http")
+		}
+		return httpToken{url: tp.URL, client: &http.Client{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown server.token_provider.type %q (supported: env|command|http)", tp.Type)
+	}
+}
+
+// fetchToken asks the provider for a token, retrying failures with a
+// doubling delay. Each attempt is bounded by server.token_provider.timeout;
+// canceling ctx, e.g. on Ctrl+C, stops the attempt in progress and the
+// retries.
+func fetchToken(ctx context.Context, p tokenProvider, attempts int, timeout time.Duration) (string, error) {
+	delay := time.Second
+	var err error
+	for i := 1; i <= attempts; i++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		var token string
+		token, err = p.Token(attemptCtx)
+		cancel()
+		if err == nil && token == "" {
+			err = errors.New("provider returned an empty token")
+		}
+		if err == nil {
+			return token, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if i < attempts {
+			log.Warn("token provider failed, retrying", "attempt", i, "of", attempts, "in", delay, "err", err)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return "", ctx.Err()
+			}
+			delay *= 2
+		}
+	}
+	return "", fmt.Errorf("token provider failed after %d attempts: %w", attempts, err)
+}
+
+// tokenRefresher fetches a new token every server.token_provider.
+// refresh_interval in the background, so re-subscribing uses a fresh token
+// without waiting for the provider, and a provider that is down at that
+// moment doesn't stop the client as long as the last token is valid.
+type tokenRefresher struct {
+	provider tokenProvider
+	attempts int
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	token string // "" until the first refresh
+}
+
+func newTokenRefresher(cfg *internal.Config) (*tokenRefresher, error) {
+	provider, err := newTokenProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tp := cfg.Server.TokenProvider
+	return &tokenRefresher{provider: provider, attempts: tp.Attempts, timeout: tp.Timeout}, nil
+}
+
+func (r *tokenRefresher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		token, err := fetchToken(ctx, r.provider, r.attempts, r.timeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn("token refresh failed, keeping the previous token", "err", err)
+			continue
+		}
+		r.mu.Lock()
+		r.token = token
+		r.mu.Unlock()
+		log.Debug("authorization token refreshed")
+	}
+}
+
+// current returns the latest refreshed token, "" if there is none yet.
+func (r *tokenRefresher) current() string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.token
+}
+
+// authMetadata returns the metadata carrying token as configured by
+// server.auth_scheme and server.auth_header: the token as is in
+// authorization by default, "Bearer <token>" for bearer, and the token as
+// is in x-api-key for x-api-key. auth_header replaces the key in any case.
+func authMetadata(cfg *internal.Config, token string) metadata.MD {
+	key, value := "authorization", token
+	switch cfg.Server.AuthScheme {
+	case internal.AuthBearer:
+		if !strings.HasPrefix(strings.ToLower(token), "bearer ") {
+			value = "Bearer " + token
+		}
+	case internal.AuthAPIKey:
+		key = "x-api-key"
+	}
+	if h := cfg.Server.AuthHeader; h != "" {
+		key = h
+	}
+	return metadata.Pairs(key, value)
+}
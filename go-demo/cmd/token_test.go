@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingToken fails every call, counting them.
+type failingToken struct{ calls *int }
+
+func (t failingToken) Token(context.Context) (string, error) {
+	*t.calls++
+	return "", errors.New("provider down")
+}
+
+func TestFetchTokenStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	time.AfterFunc(50*time.Millisecond, cancel) // during the first 1s retry delay
+
+	start := time.Now()
+	_, err := fetchToken(ctx, failingToken{&calls}, 5, time.Second)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("fetchToken = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("fetchToken returned after %s, want right after the cancel", d)
+	}
+	if calls != 1 {
+		t.Errorf("provider called %d times, want 1", calls)
+	}
+}
+
+func TestFetchTokenEnv(t *testing.T) {
+	if _, err := fetchToken(context.Background(), envToken{name: "CORECAST_TEST_UNSET_TOKEN"}, 1, time.Second); err == nil {
+		t.Error("an unset environment variable gave no error")
+	}
+	t.Setenv("CORECAST_TEST_TOKEN", "secret")
+	if token, err := fetchToken(context.Background(), envToken{name: "CORECAST_TEST_TOKEN"}, 1, time.Second); err != nil || token != "secret" {
+		t.Errorf("fetchToken = %q, %v; want secret", token, err)
+	}
+}
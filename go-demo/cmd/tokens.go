@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+)
+
+// currency is the subset of the proto Currency message the token tracker needs.
+type currency interface {
+	GetMintAddress() []byte
+	GetSymbol() string
+}
+
+type seenToken struct {
+	Mint      string    `json:"mint"`
+	Symbol    string    `json:"symbol,omitempty"`
+	Slot      uint64    `json:"slot"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// tokenTracker remembers every mint observed on the stream and reports each
+// one only the first time it appears. When a state file is configured, new
+// mints are appended to it as JSON lines so the set survives restarts.
+type tokenTracker struct {
+	mu   sync.Mutex // shared by the consumers of all stream types
+	seen map[string]seenToken
+	file *os.File
+}
+
+func newTokenTracker(path string) (*tokenTracker, error) {
+	t := &tokenTracker{seen: make(map[string]seenToken)}
+	if path == "" {
+		return t, nil
+	}
+
+	if err := t.load(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	t.file = f
+	log.Info("seen tokens loaded", "path", path, "count", len(t.seen))
+	return t, nil
+}
+
+func (t *tokenTracker) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var tok seenToken
+		if err := json.Unmarshal(scanner.Bytes(), &tok); err != nil || tok.Mint == "" {
+			log.Warn("skipping malformed seen token entry", "path", path, "err", err)
+			continue
+		}
+		t.seen[tok.Mint] = tok
+	}
+	return scanner.Err()
+}
+
+// observe records the mints of the given currencies and logs the ones not seen before.
+func (t *tokenTracker) observe(slot uint64, currencies ...currency) {
+	fresh := t.add(slot, currencies...)
+	if len(fresh) == 0 {
+		return
+	}
+	t.mu.Lock()
+	total := len(t.seen)
+	t.mu.Unlock()
+	for _, tok := range fresh {
+		log.Info(
+			"NewToken",
+			"Mint", tok.Mint,
+			"Symbol", tok.Symbol,
+			"Slot", tok.Slot,
+			"FirstSeen", tok.FirstSeen.Format(time.RFC3339),
+			"Total", total,
+		)
+	}
+}
+
+// add records the mints of the given currencies and returns the ones not
+// seen before.
+func (t *tokenTracker) add(slot uint64, currencies ...currency) []seenToken {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var fresh []seenToken
+	for _, c := range currencies {
+		if len(c.GetMintAddress()) == 0 {
+			continue
+		}
+		mint := base58.Encode(c.GetMintAddress())
+		if _, ok := t.seen[mint]; ok {
+			continue
+		}
+
+		tok := seenToken{Mint: mint, Symbol: c.GetSymbol(), Slot: slot, FirstSeen: time.Now().UTC()}
+		t.seen[mint] = tok
+		t.persist(tok)
+		fresh = append(fresh, tok)
+	}
+	return fresh
+}
+
+func (t *tokenTracker) persist(tok seenToken) {
+	if t.file == nil {
+		return
+	}
+	line, err := json.Marshal(tok)
+	if err != nil {
+		return
+	}
+	if _, err := t.file.Write(append(line, '\n')); err != nil {
+		log.Error("seen tokens write failed", "err", err)
+	}
+}
+
+func (t *tokenTracker) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
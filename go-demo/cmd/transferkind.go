@@ -0,0 +1,26 @@
+package main
+
+import "bytes"
+
+const (
+	transferNative = "native"
+	transferSPL    = "spl"
+)
+
+// nativeMint is the all-zero address (base58 "11111111111111111111111111111111",
+// the System Program) that some producers put in MintAddress for native SOL.
+var nativeMint = make([]byte, 32)
+
+// transferKind tells native SOL transfers from SPL token transfers. Native
+// SOL is flagged by Currency.Native; an empty or all-zero mint is treated the
+// same way. Wrapped SOL (So111...112) is an SPL token and reported as spl.
+func transferKind(cur interface {
+	GetNative() bool
+	GetMintAddress() []byte
+}) string {
+	mint := cur.GetMintAddress()
+	if cur.GetNative() || len(mint) == 0 || bytes.Equal(mint, nativeMint) {
+		return transferNative
+	}
+	return transferSPL
+}
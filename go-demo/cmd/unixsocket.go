@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	unixRedialInterval = time.Second
+	// unixWriteTimeout is how long a reader may hold up a write before it is
+	// disconnected, so one stalled reader can't block the others or the
+	// stream.
+	unixWriteTimeout = time.Second
+)
+
+// unixSocketWriter sends output lines over a Unix domain socket, either to
+// every client connected to a socket it listens on, or to a socket it
+// connects to. Lines written while nobody is connected are dropped.
+type unixSocketWriter struct {
+	path    string
+	listen  bool
+	ln      net.Listener
+	timeout time.Duration // per write, see unixWriteTimeout
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	lastDial time.Time
+	dropped  uint64
+}
+
+func newUnixSocketWriter(path, mode string) (*unixSocketWriter, error) {
+	w := &unixSocketWriter{path: path, timeout: unixWriteTimeout}
+	switch mode {
+	case "", "listen":
+		w.listen = true
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		w.ln = ln
+		go w.accept()
+		log.Info("unix socket listening", "path", path)
+	case "connect":
+		w.dial()
+	default:
+		return nil, errors.New("output.unix_socket.mode must be listen or connect")
+	}
+	return w, nil
+}
+
+func (w *unixSocketWriter) accept() {
+	for {
+		conn, err := w.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error("unix socket accept", "err", err)
+			}
+			return
+		}
+		log.Info("unix socket client connected")
+		w.mu.Lock()
+		w.conns = append(w.conns, conn)
+		w.mu.Unlock()
+	}
+}
+
+// dial (re)connects in connect mode, at most once per unixRedialInterval.
+// Callers other than the constructor must hold w.mu.
+func (w *unixSocketWriter) dial() {
+	if time.Since(w.lastDial) < unixRedialInterval {
+		return
+	}
+	w.lastDial = time.Now()
+	conn, err := net.Dial("unix", w.path)
+	if err != nil {
+		log.Warn("unix socket connect", "path", w.path, "err", err)
+		return
+	}
+	log.Info("unix socket connected", "path", w.path)
+	w.conns = []net.Conn{conn}
+}
+
+// Write sends p to every connection, dropping the ones that fail or don't
+// take p within w.timeout. It never returns an error so a disconnected or
+// stalled reader doesn't stop the stream.
+func (w *unixSocketWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.listen && len(w.conns) == 0 {
+		w.dial()
+	}
+	if len(w.conns) == 0 {
+		w.dropped++
+		return len(p), nil
+	}
+
+	alive := w.conns[:0]
+	for _, conn := range w.conns {
+		conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		if _, err := conn.Write(p); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Warn("unix socket client too slow, disconnected", "timeout", w.timeout)
+			} else {
+				log.Info("unix socket client gone", "err", err)
+			}
+			conn.Close()
+			continue
+		}
+		alive = append(alive, conn)
+	}
+	w.conns = alive
+	return len(p), nil
+}
+
+func (w *unixSocketWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, conn := range w.conns {
+		conn.Close()
+	}
+	w.conns = nil
+	if w.dropped > 0 {
+		log.Info("unix socket records dropped while disconnected", "count", w.dropped)
+	}
+	if w.ln != nil {
+		return w.ln.Close()
+	}
+	return nil
+}
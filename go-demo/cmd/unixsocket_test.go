@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocketDropsStalledReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.sock")
+	w, err := newUnixSocketWriter(path, "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.timeout = 50 * time.Millisecond
+
+	// One reader that never reads, one that does.
+	stalled, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	reader, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for deadline := time.Now().Add(time.Second); ; {
+		w.mu.Lock()
+		n := len(w.conns)
+		w.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients accepted, want 2", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	lines := make(chan int)
+	go func() {
+		n := 0
+		sc := bufio.NewScanner(reader)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			n++
+		}
+		lines <- n
+	}()
+
+	// Enough to fill the socket buffer of the stalled reader many times.
+	line := append(bytes.Repeat([]byte("x"), 64<<10), '\n')
+	const writes = 100
+	start := time.Now()
+	for range writes {
+		w.Write(line)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("writes took %s with a stalled reader", d)
+	}
+	w.mu.Lock()
+	n := len(w.conns)
+	w.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("%d clients left, want only the reading one", n)
+	}
+
+	w.Close()
+	if got := <-lines; got != writes {
+		t.Errorf("reader got %d lines, want %d", got, writes)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "runtime/debug"
+
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...
+// -X main.buildDate=...". Left empty, commit and buildDate fall back to the
+// VCS information the go tool embeds when building from a git checkout.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo returns the version, commit and build date of the binary.
+func buildInfo() (ver, rev, date string) {
+	ver, rev, date = version, commit, buildDate
+	dirty := false
+	if info, ok := debug.ReadBuildInfo(); ok && (rev == "" || date == "") {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if rev == "" {
+					rev = s.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = s.Value
+				}
+			case "vcs.modified":
+				dirty = s.Value == "true" && commit == ""
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	} else if dirty {
+		rev += "-dirty"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return ver, rev, date
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/mr-tron/base58"
+
+	"corecast-client-example/internal/encode"
+)
+
+type washKey struct {
+	trader string
+	mint   string
+}
+
+type washActivity struct {
+	key         washKey
+	buys, sells []time.Time
+	flagged     time.Time
+}
+
+// washTradeRecord is written to the output when a (trader, mint) pair
+// completes the pattern.
+type washTradeRecord struct {
+	Trader    string `output:"Trader"`
+	Mint      string `output:"Mint"`
+	Buys      int    `output:"Buys"`
+	Sells     int    `output:"Sells"`
+	Window    string `output:"Window"`
+	Slot      uint64 `output:"Slot"`
+	Signature string `output:"Signature"`
+}
+
+// washDetector flags traders that buy and sell the same token repeatedly
+// within a short window. Only the window's timestamps are kept per
+// (trader, mint), and the number of tracked pairs is capped by evicting the
+// least recently active pair.
+type washDetector struct {
+	window     time.Duration
+	minTrips   int
+	maxTracked int
+	order      *list.List // of *washActivity, most recently active first
+	activity   map[washKey]*list.Element
+}
+
+func newWashDetector(window time.Duration, minTrips, maxTracked int) *washDetector {
+	return &washDetector{
+		window:     window,
+		minTrips:   minTrips,
+		maxTracked: maxTracked,
+		order:      list.New(),
+		activity:   make(map[washKey]*list.Element),
+	}
+}
+
+// observe records that trader bought boughtMint and sold soldMint at slot,
+// and returns a record for each side that completes the pattern.
+func (d *washDetector) observe(slot uint64, signature, trader, boughtMint, soldMint []byte) []washTradeRecord {
+	if len(trader) == 0 {
+		return nil
+	}
+	now := time.Now()
+	t := base58.Encode(trader)
+	var flagged []washTradeRecord
+	if len(boughtMint) > 0 {
+		if rec, ok := d.record(now, slot, signature, washKey{t, base58.Encode(boughtMint)}, true); ok {
+			flagged = append(flagged, rec)
+		}
+	}
+	if len(soldMint) > 0 {
+		if rec, ok := d.record(now, slot, signature, washKey{t, base58.Encode(soldMint)}, false); ok {
+			flagged = append(flagged, rec)
+		}
+	}
+	return flagged
+}
+
+func (d *washDetector) record(now time.Time, slot uint64, signature []byte, key washKey, buy bool) (washTradeRecord, bool) {
+	var a *washActivity
+	if e, ok := d.activity[key]; ok {
+		d.order.MoveToFront(e)
+		a = e.Value.(*washActivity)
+	} else {
+		if d.order.Len() >= d.maxTracked {
+			oldest := d.order.Back()
+			d.order.Remove(oldest)
+			delete(d.activity, oldest.Value.(*washActivity).key)
+		}
+		a = &washActivity{key: key}
+		d.activity[key] = d.order.PushFront(a)
+	}
+
+	cutoff := now.Add(-d.window)
+	a.buys = trimBefore(a.buys, cutoff)
+	a.sells = trimBefore(a.sells, cutoff)
+	if buy {
+		a.buys = append(a.buys, now)
+	} else {
+		a.sells = append(a.sells, now)
+	}
+
+	if len(a.buys) < d.minTrips || len(a.sells) < d.minTrips || a.flagged.After(cutoff) {
+		return washTradeRecord{}, false
+	}
+	a.flagged = now
+	return washTradeRecord{
+		Trader:    key.trader,
+		Mint:      key.mint,
+		Buys:      len(a.buys),
+		Sells:     len(a.sells),
+		Window:    d.window.String(),
+		Slot:      slot,
+		Signature: encode.Signature(signature),
+	}, true
+}
+
+// trimBefore drops the timestamps older than cutoff from a sorted slice.
+func trimBefore(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mr-tron/base58"
+
+	"corecast-client-example/internal"
+)
+
+func TestWashDetector(t *testing.T) {
+	d := newWashDetector(time.Minute, 2, 10)
+	trader, mint, quote := []byte("trader"), []byte("mint"), []byte("quote")
+
+	// Buy, sell, buy: one round trip and a half, nothing yet.
+	for i, buy := range []bool{true, false, true} {
+		bought, sold := quote, mint
+		if buy {
+			bought, sold = mint, quote
+		}
+		if recs := d.observe(uint64(i), []byte{1}, trader, bought, sold); len(recs) != 0 {
+			t.Fatalf("trade %d flagged %+v before two round trips", i, recs)
+		}
+	}
+	recs := d.observe(4, []byte{2}, trader, quote, mint)
+	var flagged *washTradeRecord
+	for i := range recs {
+		if recs[i].Mint == base58.Encode(mint) {
+			flagged = &recs[i]
+		}
+	}
+	if flagged == nil || flagged.Buys != 2 || flagged.Sells != 2 || flagged.Trader != base58.Encode(trader) || flagged.Slot != 4 {
+		t.Fatalf("second round trip = %+v, want mint flagged with 2 buys and 2 sells at slot 4", recs)
+	}
+	// Flagged at most once per window.
+	for _, r := range d.observe(5, []byte{3}, trader, mint, quote) {
+		if r.Mint == base58.Encode(mint) {
+			t.Errorf("mint flagged again within the window: %+v", r)
+		}
+	}
+}
+
+func TestWashDetectorEvictsLeastRecentlyActive(t *testing.T) {
+	d := newWashDetector(time.Minute, 1, 2)
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+	d.observe(1, nil, a, []byte("m"), nil)
+	d.observe(2, nil, b, []byte("m"), nil)
+	d.observe(3, nil, a, []byte("m"), nil) // a is now the most recent
+	d.observe(4, nil, c, []byte("m"), nil) // evicts b
+
+	if len(d.activity) != 2 || d.order.Len() != 2 {
+		t.Fatalf("%d pairs tracked (%d in the list), want 2", len(d.activity), d.order.Len())
+	}
+	for trader, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := d.activity[washKey{base58.Encode([]byte(trader)), base58.Encode([]byte("m"))}]; ok != want {
+			t.Errorf("trader %s tracked = %v, want %v", trader, ok, want)
+		}
+	}
+}
+
+func TestEmitRecordProtoJSON(t *testing.T) {
+	var out bytes.Buffer
+	c := newTestConsumer(&internal.Config{}, "dex_trades")
+	c.json = &protoJSONWriter{out: &out}
+	var err error
+	if c.redact, err = newRedactor("", map[string]string{"Trader": redactBlank}); err != nil {
+		t.Fatal(err)
+	}
+
+	c.sinks = []sink{sinkFunc(c.writeJSON)}
+	c.emitRecord("dex_trades", "WashTradeSuspect", washTradeRecord{Trader: "T", Mint: "M", Buys: 2, Sells: 3, Slot: 9})
+	var line map[string]map[string]any
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("%q: %v", out.String(), err)
+	}
+	rec := line["WashTradeSuspect"]
+	if rec["Mint"] != "M" || rec["Sells"] != 3.0 || rec["Slot"] != 9.0 || rec["Trader"] != "" {
+		t.Errorf("record = %v, want Mint M, Sells 3, Slot 9 and Trader blanked", rec)
+	}
+}
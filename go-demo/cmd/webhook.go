@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// postWebhook POSTs v as JSON to url and treats any non-2xx answer as an error.
+func postWebhook(url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// webhookQueueSize is how many alerts a webhookQueue holds while a post is
+// in progress.
+const webhookQueueSize = 64
+
+// webhookQueue posts alerts to a webhook one at a time from run, so a burst
+// of alerts or a slow endpoint doesn't pile up goroutines or hold up the
+// stream. Alerts that don't fit in the queue are dropped with a warning. A
+// nil queue drops everything silently.
+type webhookQueue struct {
+	url    string
+	name   string // the alert kind, for the logs
+	alerts chan any
+}
+
+func newWebhookQueue(name, url string) *webhookQueue {
+	return &webhookQueue{url: url, name: name, alerts: make(chan any, webhookQueueSize)}
+}
+
+// post queues v to be POSTed as JSON without blocking.
+func (q *webhookQueue) post(v any) {
+	if q == nil {
+		return
+	}
+	select {
+	case q.alerts <- v:
+	default:
+		log.Warn("webhook queue full, alert dropped", "alert", q.name)
+	}
+}
+
+// run posts the queued alerts until ctx is done.
+func (q *webhookQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-q.alerts:
+			if err := postWebhook(q.url, v); err != nil {
+				log.Error("alert webhook", "alert", q.name, "err", err)
+			}
+		}
+	}
+}
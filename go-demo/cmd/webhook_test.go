@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookQueue(t *testing.T) {
+	bodies := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		select {
+		case bodies <- body:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	q := newWebhookQueue("price_change", srv.URL)
+	// Nothing posts yet: the queue fills up, then drops instead of blocking.
+	for range webhookQueueSize + 1 {
+		q.post(priceAlert{Alert: "price_change", Base: "B", Slot: 7})
+	}
+	if len(q.alerts) != webhookQueueSize {
+		t.Fatalf("queue holds %d alerts, want %d", len(q.alerts), webhookQueueSize)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.run(ctx)
+	select {
+	case body := <-bodies:
+		if body["Alert"] != "price_change" || body["Base"] != "B" || body["Slot"] != 7.0 {
+			t.Errorf("webhook body = %v", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing posted")
+	}
+
+	var nilQueue *webhookQueue
+	nilQueue.post(priceAlert{}) // no webhook configured
+}
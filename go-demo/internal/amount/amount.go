@@ -0,0 +1,52 @@
+// Package amount converts raw on-chain token amounts, integers in the
+// token's smallest unit, into decimal values using the currency's decimals.
+package amount
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal returns raw scaled down by 10^decimals as an exact decimal
+// string without trailing zeros, e.g. Decimal(1500000, 6) == "1.5". With
+// zero decimals, as reported for a missing currency, raw is returned as is.
+func Decimal(raw uint64, decimals uint32) string {
+	digits := strconv.FormatUint(raw, 10)
+	if decimals == 0 || raw == 0 {
+		return digits
+	}
+	d := int(decimals)
+	if len(digits) <= d {
+		digits = strings.Repeat("0", d-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-d], strings.TrimRight(digits[len(digits)-d:], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// Float returns raw scaled down by 10^decimals as a big.Float, for
+// arithmetic on normalized amounts.
+func Float(raw uint64, decimals uint32) *big.Float {
+	f, _ := new(big.Float).SetPrec(128).SetString(Decimal(raw, decimals))
+	return f
+}
+
+// Delta returns post - pre as signed decimal strings, raw and scaled down by
+// 10^decimals, e.g. Delta(2000000, 500000, 6) == ("-1500000", "-1.5"). The
+// difference is computed on big integers, as it can exceed an int64; zero
+// has no sign.
+func Delta(pre, post uint64, decimals uint32) (raw, normalized string) {
+	d := new(big.Int).Sub(new(big.Int).SetUint64(post), new(big.Int).SetUint64(pre))
+	sign := ""
+	switch d.Sign() {
+	case 1:
+		sign = "+"
+	case -1:
+		sign = "-"
+	}
+	abs := d.Abs(d).Uint64() // |post - pre| <= max(pre, post) fits
+	return sign + strconv.FormatUint(abs, 10), sign + Decimal(abs, decimals)
+}
@@ -1,8 +1,17 @@
 package internal
 
 import (
+	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/mr-tron/base58"
+	"google.golang.org/grpc/codes"
 	"gopkg.in/yaml.v3"
 )
 
@@ -11,10 +20,252 @@ type Config struct {
 		Address       string `yaml:"address"`
 		Insecure      bool   `yaml:"insecure"`
 		Authorization string `yaml:"authorization"`
+		// AuthScheme is how the token is attached: raw (default) sends it
+		// as is in authorization, bearer as "Bearer <token>", x-api-key as
+		// is in x-api-key. AuthHeader overrides the metadata key.
+		AuthScheme string `yaml:"auth_scheme"`
+		AuthHeader string `yaml:"auth_header"`
+		// AllowInsecureAuth permits sending the authorization token over a
+		// plaintext connection. Meant for intentional local testing only.
+		AllowInsecureAuth bool `yaml:"allow_insecure_auth"`
+		// Compression is the gRPC compressor used on the connection: none
+		// (default), gzip or zstd.
+		Compression string `yaml:"compression"`
+		// TLS adds a private CA, a client certificate for mutual TLS and a
+		// server name override to the TLS connection.
+		TLS struct {
+			CAFile     string `yaml:"ca_file"`
+			CertFile   string `yaml:"cert_file"`
+			KeyFile    string `yaml:"key_file"`
+			ServerName string `yaml:"server_name"`
+		} `yaml:"tls"`
+		// Keepalive configures the HTTP/2 pings of the connection; omitted
+		// fields default to 15s / 5s / true.
+		Keepalive struct {
+			Time                time.Duration `yaml:"time"`
+			Timeout             time.Duration `yaml:"timeout"`
+			PermitWithoutStream *bool         `yaml:"permit_without_stream"`
+		} `yaml:"keepalive"`
+		// ConnectRetries bounds the subscribe attempts that fail before a
+		// stream has received its first message (default 5, negative =
+		// unlimited); ConnectBackoff is the first delay between them, and
+		// the delay the backoff starts over from once messages arrived.
+		ConnectRetries int           `yaml:"connect_retries"`
+		ConnectBackoff time.Duration `yaml:"connect_backoff"`
+		// TokenProvider, when Type is set, replaces Authorization with a
+		// token fetched on every connect.
+		TokenProvider struct {
+			Type     string        `yaml:"type"` // env | command | http
+			Env      string        `yaml:"env"`
+			Command  []string      `yaml:"command"`
+			URL      string        `yaml:"url"`
+			Attempts int           `yaml:"attempts"`
+			Timeout  time.Duration `yaml:"timeout"`
+			// RefreshInterval fetches a new token in the background this
+			// often, for the next re-subscribe (0 = fetch on re-subscribe).
+			RefreshInterval time.Duration `yaml:"refresh_interval"`
+		} `yaml:"token_provider"`
 	} `yaml:"server"`
+	Tuning struct {
+		InitialWindowSize     int32 `yaml:"initial_window_size"`
+		InitialConnWindowSize int32 `yaml:"initial_conn_window_size"`
+		ReadBufferSize        int   `yaml:"read_buffer_size"`
+		WriteBufferSize       int   `yaml:"write_buffer_size"`
+		MaxRecvMsgSize        int   `yaml:"max_recv_msg_size"`
+		MaxSendMsgSize        int   `yaml:"max_send_msg_size"`
+		TCPKeepalive          struct {
+			Enabled  bool          `yaml:"enabled"`
+			Idle     time.Duration `yaml:"idle"`
+			Interval time.Duration `yaml:"interval"`
+			Count    int           `yaml:"count"`
+		} `yaml:"tcp_keepalive"`
+	} `yaml:"tuning"`
 	Stream struct {
 		Type string `yaml:"type"`
+		// Types subscribes to several stream types over one connection,
+		// instead of Type.
+		Types []string `yaml:"types"`
+		// FailFast stops every stream once one of them has failed for good;
+		// otherwise the remaining streams keep running.
+		FailFast       bool   `yaml:"fail_fast"`
+		Mode           string `yaml:"mode"`
+		SeenTokensFile string `yaml:"seen_tokens_file"`
+		MaxBytesPerSec int    `yaml:"max_bytes_per_sec"`
+		// HeartbeatInterval logs a Stats line per stream every interval
+		// (0 = off). Unlike output.heartbeat_interval it is always logged
+		// and only goes to the log.
+		HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+		// LatencyInterval samples the delivery latency of each stream once
+		// per interval, using rpc.url for block times (0 = off).
+		LatencyInterval time.Duration `yaml:"latency_interval"`
+		// MaxBackoff caps the doubling delay between re-subscribe attempts.
+		MaxBackoff time.Duration `yaml:"max_backoff"`
+		// IdleTimeout re-subscribes a stream that received nothing for that
+		// long, ahead of load balancers that drop idle connections (0 = off).
+		IdleTimeout time.Duration `yaml:"idle_timeout"`
+		// MaxMessages and MaxDuration stop the client cleanly after that
+		// many messages, across all stream types, or that long (0 = no limit).
+		MaxMessages uint64        `yaml:"max_messages"`
+		MaxDuration time.Duration `yaml:"max_duration"`
+		// FromSlot is the slot to resume after when there is no checkpoint.
+		// The subscribe requests have no start slot, so the server ignores
+		// it; the client only reports the slots missed.
+		FromSlot uint64 `yaml:"from_slot"`
+		// RecoverPanics logs and skips a message whose processing panics
+		// instead of crashing. Defaults to true.
+		RecoverPanics *bool `yaml:"recover_panics"`
+		// Checkpoint saves the last processed slot per stream type to File
+		// every Interval and on shutdown, and reads it back on startup.
+		Checkpoint struct {
+			File     string        `yaml:"file"`
+			Interval time.Duration `yaml:"interval"`
+		} `yaml:"checkpoint"`
 	} `yaml:"stream"`
+	Reconnect struct {
+		// OnCodes are the gRPC status codes, by name, that a stream is
+		// subscribed again after; any other status ends it for good. A
+		// clean end by the server (EOF) is governed by OnEOF.
+		OnCodes []string `yaml:"on_codes"`
+		// OnEOF re-subscribes a stream the server ended cleanly. By default
+		// the stream stops there, and the process exits 0 once no stream
+		// is left.
+		OnEOF bool `yaml:"on_eof"`
+	} `yaml:"reconnect"`
+	Output struct {
+		Format            string        `yaml:"format"`
+		Fields            []string      `yaml:"fields"`
+		HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+		// FullSampleInterval logs one complete message as protojson per
+		// interval in log format (0 = off).
+		FullSampleInterval time.Duration `yaml:"full_sample_interval"`
+		// Rename maps console log keys and the field names of the protojson
+		// and Kafka output to new names; "-" drops the key. The csv columns
+		// keep their names.
+		Rename map[string]string `yaml:"rename"`
+		// RecordHash adds a RecordHash key, the SHA-256 of the message as
+		// received, to every message written by protojson and Kafka.
+		RecordHash bool `yaml:"record_hash"`
+		// Prefix namespaces the sink destinations of this pipeline, see
+		// applyPrefix.
+		Prefix string `yaml:"prefix"`
+		// GroupByBlock emits the events of each slot as one block record,
+		// holding at most MaxBlockEvents before a partial block is flushed.
+		GroupByBlock   bool `yaml:"group_by_block"`
+		MaxBlockEvents int  `yaml:"max_block_events"`
+		File           struct {
+			Path       string `yaml:"path"`
+			MaxSizeMB  int    `yaml:"max_size_mb"`
+			MaxBackups int    `yaml:"max_backups"`
+		} `yaml:"file"`
+		UnixSocket struct {
+			Path string `yaml:"path"`
+			Mode string `yaml:"mode"`
+		} `yaml:"unix_socket"`
+		Exec struct {
+			Command []string `yaml:"command"`
+			Buffer  int      `yaml:"buffer"`
+		} `yaml:"exec"`
+		// BatchSize accumulates up to this many records before writing them
+		// out together, or FlushInterval after the first (<= 1 = off).
+		BatchSize     int           `yaml:"batch_size"`
+		FlushInterval time.Duration `yaml:"flush_interval"`
+		// RawDump appends every message as received, before decoding, to
+		// this file as length-prefixed protobuf frames, for -replay.
+		RawDump string `yaml:"raw_dump"`
+		// Kafka produces every message as proto JSON to Topic, alongside
+		// the regular output, keyed by the KeyField path (the transaction
+		// signature by default).
+		Kafka struct {
+			Brokers     []string `yaml:"brokers"`
+			Topic       string   `yaml:"topic"`
+			KeyField    string   `yaml:"key_field"`
+			MaxAttempts int      `yaml:"max_attempts"`
+			// SpillFile keeps the messages not yet acknowledged, to be
+			// produced again after a crash (at-least-once delivery).
+			SpillFile string `yaml:"spill_file"`
+		} `yaml:"kafka"`
+		Redact struct {
+			Salt   string            `yaml:"salt"`
+			Fields map[string]string `yaml:"fields"`
+		} `yaml:"redact"`
+	} `yaml:"output"`
+	Analyzers struct {
+		WashTrading struct {
+			Enabled       bool          `yaml:"enabled"`
+			Window        time.Duration `yaml:"window"`
+			MinRoundTrips int           `yaml:"min_round_trips"`
+			MaxTracked    int           `yaml:"max_tracked"`
+		} `yaml:"wash_trading"`
+		PriceChange struct {
+			Enabled      bool          `yaml:"enabled"`
+			ThresholdPct float64       `yaml:"threshold_pct"`
+			Window       time.Duration `yaml:"window"`
+			MinTrades    int           `yaml:"min_trades"`
+			MaxTracked   int           `yaml:"max_tracked"`
+			Webhook      string        `yaml:"webhook"`
+		} `yaml:"price_change"`
+	} `yaml:"analyzers"`
+	Alerts struct {
+		// RateFloor fires when the smoothed messages/sec stays below
+		// MinRate for For, and clears once it is back above ClearRate.
+		RateFloor struct {
+			MinRate   float64       `yaml:"min_rate"`
+			ClearRate float64       `yaml:"clear_rate"`
+			For       time.Duration `yaml:"for"`
+			Webhook   string        `yaml:"webhook"`
+		} `yaml:"rate_floor"`
+	} `yaml:"alerts"`
+	Metrics struct {
+		// Listen is the address of the Prometheus /metrics endpoint, e.g.
+		// ":9100"; empty disables it.
+		Listen string `yaml:"listen"`
+	} `yaml:"metrics"`
+	Health struct {
+		// Listen is the address of the /healthz and /readyz endpoints, e.g.
+		// ":8080"; empty disables them. It may equal metrics.listen.
+		Listen string `yaml:"listen"`
+		// MaxStaleness is how long a stream may go without a message
+		// before /readyz reports it as not ready.
+		MaxStaleness time.Duration `yaml:"max_staleness"`
+	} `yaml:"health"`
+	Dedup struct {
+		// WindowSize is the number of recent event keys remembered to drop
+		// duplicates; 0 = off.
+		WindowSize int `yaml:"window_size"`
+		// Key is the dedup key per stream type, one of the Dedup* values;
+		// omitted stream types get the first of dedupKeys.
+		Key map[string]string `yaml:"key"`
+	} `yaml:"dedup"`
+	Logging struct {
+		// Level is the lowest level logged: debug, info, warn or error.
+		Level string `yaml:"level"`
+		// Format is terminal, json or logfmt; empty picks terminal when
+		// stdout is a terminal and logfmt otherwise.
+		Format string `yaml:"format"`
+	} `yaml:"logging"`
+	Shutdown struct {
+		// GracePeriod bounds how long buffered output is flushed after
+		// SIGINT/SIGTERM before the process exits anyway.
+		GracePeriod time.Duration `yaml:"grace_period"`
+	} `yaml:"shutdown"`
+	Debug struct {
+		// StallProfile writes goroutine and CPU profiles to Dir when no
+		// message arrived for After.
+		StallProfile struct {
+			Dir         string        `yaml:"dir"`
+			After       time.Duration `yaml:"after"`
+			CPUDuration time.Duration `yaml:"cpu_duration"`
+		} `yaml:"stall_profile"`
+	} `yaml:"debug"`
+	RPC struct {
+		URL     string        `yaml:"url"`
+		Timeout time.Duration `yaml:"timeout"`
+	} `yaml:"rpc"`
+	ProgramLogs struct {
+		Enabled  bool   `yaml:"enabled"`
+		Contains string `yaml:"contains"`
+		MaxLines int    `yaml:"max_lines"`
+	} `yaml:"program_logs"`
 	Filters struct {
 		Programs  []string `yaml:"programs"`
 		Pools     []string `yaml:"pools"`
@@ -24,6 +275,59 @@ type Config struct {
 		Receivers []string `yaml:"receivers"`
 		Addresses []string `yaml:"addresses"`
 		Signers   []string `yaml:"signers"`
+		// DexNames adds the program addresses of well-known DEXes, by name
+		// or family (e.g. raydium, orca_whirlpool), to Programs.
+		DexNames []string `yaml:"dex_names"`
+
+		// The *File fields name files with one address per line that are
+		// appended to the filter of the same name. Blank lines and lines
+		// starting with # are skipped; relative paths are resolved against
+		// the config file's directory.
+		ProgramsFile  string `yaml:"programs_file"`
+		PoolsFile     string `yaml:"pools_file"`
+		TokensFile    string `yaml:"tokens_file"`
+		TradersFile   string `yaml:"traders_file"`
+		SendersFile   string `yaml:"senders_file"`
+		ReceiversFile string `yaml:"receivers_file"`
+		AddressesFile string `yaml:"addresses_file"`
+		SignersFile   string `yaml:"signers_file"`
+
+		// AllowEmpty permits subscribing with none of the stream's filters
+		// set, i.e. to the whole firehose of that stream type.
+		AllowEmpty bool `yaml:"allow_empty"`
+		// Strict rejects filter addresses that are not base58 encoded 32
+		// byte keys. Defaults to true; set it to false to pass non-standard
+		// values to the server as they are.
+		Strict *bool `yaml:"strict"`
+
+		// MinSOLValue drops transactions whose fee plus lamports credited
+		// to accounts is below this many SOL (transactions stream only).
+		MinSOLValue float64 `yaml:"min_sol_value"`
+		// MinAmount drops trades whose buy and sell amounts, in whole
+		// tokens, are both below the minimum for their mint; the "*" key
+		// applies to mints without an entry (dex_trades stream only).
+		MinAmount map[string]float64 `yaml:"min_amount"`
+		// IncludeMints keeps only transfers and balance updates of these
+		// mints; ExcludeMints drops those of these mints, and wins when a
+		// mint is in both (transfers and balances streams only).
+		IncludeMints []string `yaml:"include_mints"`
+		ExcludeMints []string `yaml:"exclude_mints"`
+		// TransferKind keeps only native SOL ("native") or SPL token
+		// ("spl") transfers (transfers stream only).
+		TransferKind string `yaml:"transfer_kind"`
+		// TransferMinAmount drops transfers below this amount in whole
+		// tokens, i.e. normalized by the currency's decimals.
+		TransferMinAmount float64 `yaml:"transfer_min_amount"`
+		// TransferInstructionIndexes keeps only transfers made by the
+		// instructions at these indexes within their transaction.
+		TransferInstructionIndexes []uint32 `yaml:"transfer_instruction_indexes"`
+		// DropZeroAmount skips trades with a zero buy or sell amount,
+		// zero-amount transfers and balance updates that don't change the
+		// balance.
+		DropZeroAmount bool `yaml:"drop_zero_amount"`
+		// OrderStates keeps only order events whose type is one of these
+		// enum names, e.g. OPEN or CANCEL (dex_orders stream only).
+		OrderStates []string `yaml:"order_states"`
 	} `yaml:"filters"`
 }
 
@@ -39,5 +343,562 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.loadFilterFiles(filepath.Dir(configPath)); err != nil {
+		return nil, err
+	}
+	if err := config.resolveDexNames(); err != nil {
+		return nil, err
+	}
+	config.applyEnv()
+	config.applyDefaults()
+	config.applyPrefix()
 	return &config, nil
 }
+
+// applyPrefix folds output.prefix into the names of the sink destinations,
+// as "<prefix>.<name>": the Kafka topic, and the file names (not the
+// directories) of output.file.path, output.raw_dump and
+// output.kafka.spill_file. Validate checks the resulting names.
+func (c *Config) applyPrefix() {
+	prefix := c.Output.Prefix
+	if prefix == "" {
+		return
+	}
+	for _, path := range []*string{&c.Output.File.Path, &c.Output.RawDump, &c.Output.Kafka.SpillFile} {
+		if *path != "" {
+			*path = filepath.Join(filepath.Dir(*path), prefix+"."+filepath.Base(*path))
+		}
+	}
+	if c.Output.Kafka.Topic != "" {
+		c.Output.Kafka.Topic = prefix + "." + c.Output.Kafka.Topic
+	}
+}
+
+// validName reports whether s only holds the characters Kafka allows in a
+// topic name, which are also safe in a file name.
+func validName(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return s != "" && s != "." && s != ".."
+}
+
+// loadFilterFiles appends the addresses listed in the filters.*_file files
+// to the inline filter lists.
+func (c *Config) loadFilterFiles(dir string) error {
+	f := &c.Filters
+	for _, lf := range []struct {
+		name   string
+		path   string
+		values *[]string
+	}{
+		{"programs_file", f.ProgramsFile, &f.Programs},
+		{"pools_file", f.PoolsFile, &f.Pools},
+		{"tokens_file", f.TokensFile, &f.Tokens},
+		{"traders_file", f.TradersFile, &f.Traders},
+		{"senders_file", f.SendersFile, &f.Senders},
+		{"receivers_file", f.ReceiversFile, &f.Receivers},
+		{"addresses_file", f.AddressesFile, &f.Addresses},
+		{"signers_file", f.SignersFile, &f.Signers},
+	} {
+		if lf.path == "" {
+			continue
+		}
+		path := lf.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		values, err := readAddressFile(path)
+		if err != nil {
+			return fmt.Errorf("filters.%s: %w", lf.name, err)
+		}
+		*lf.values = append(*lf.values, values...)
+	}
+	return nil
+}
+
+// readAddressFile returns the trimmed lines of path, without blank lines
+// and # comments.
+func readAddressFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, line)
+	}
+	return values, nil
+}
+
+// Redacted returns a copy of the config that is safe to share: the
+// authorization token and the output.redact salt are replaced by a marker
+// when set.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, secret := range []*string{&r.Server.Authorization, &r.Output.Redact.Salt} {
+		if *secret != "" {
+			*secret = "<redacted>"
+		}
+	}
+	return &r
+}
+
+// applyEnv overrides file values with the BITQUERY_* and LOG_LEVEL
+// environment variables that are set, so containers can configure the client, and keep the token
+// out of the YAML, without mounting a file.
+func (c *Config) applyEnv() {
+	for name, field := range map[string]*string{
+		"BITQUERY_SERVER_ADDRESS":       &c.Server.Address,
+		"BITQUERY_SERVER_AUTHORIZATION": &c.Server.Authorization,
+		"BITQUERY_STREAM_TYPE":          &c.Stream.Type,
+		"LOG_LEVEL":                     &c.Logging.Level,
+	} {
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			*field = v
+		}
+	}
+	if os.Getenv("BITQUERY_STREAM_TYPE") != "" {
+		c.Stream.Types = nil
+	}
+}
+
+// StreamTypes returns the stream types to subscribe to: stream.types, or
+// stream.type on its own.
+func (c *Config) StreamTypes() []string {
+	if len(c.Stream.Types) > 0 {
+		return c.Stream.Types
+	}
+	if c.Stream.Type == "" {
+		return nil
+	}
+	return []string{c.Stream.Type}
+}
+
+// ParseCode returns the gRPC status code called name, in the Go
+// (ResourceExhausted) or the wire form (RESOURCE_EXHAUSTED), in any case.
+func ParseCode(name string) (codes.Code, bool) {
+	norm := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, "_", "")) }
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if norm(code.String()) == norm(name) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// ReconnectOn reports whether a stream that ended with code is subscribed
+// again, i.e. whether code is in reconnect.on_codes.
+func (c *Config) ReconnectOn(code codes.Code) bool {
+	return slices.ContainsFunc(c.Reconnect.OnCodes, func(name string) bool {
+		parsed, ok := ParseCode(name)
+		return ok && parsed == code
+	})
+}
+
+// applyDefaults fills in values that were omitted from the YAML file.
+func (c *Config) applyDefaults() {
+	if c.Dedup.Key == nil {
+		c.Dedup.Key = make(map[string]string, len(dedupKeys))
+	}
+	for st, keys := range dedupKeys {
+		if c.Dedup.Key[st] == "" {
+			c.Dedup.Key[st] = keys[0]
+		}
+	}
+	if c.Reconnect.OnCodes == nil {
+		c.Reconnect.OnCodes = []string{"Unavailable", "ResourceExhausted", "DeadlineExceeded"}
+	}
+	if c.Server.TokenProvider.Attempts == 0 {
+		c.Server.TokenProvider.Attempts = 3
+	}
+	if c.Server.TokenProvider.Timeout == 0 {
+		c.Server.TokenProvider.Timeout = 10 * time.Second
+	}
+	if c.Server.Keepalive.Time == 0 {
+		c.Server.Keepalive.Time = 15 * time.Second
+	}
+	if c.Server.Keepalive.Timeout == 0 {
+		c.Server.Keepalive.Timeout = 5 * time.Second
+	}
+	if c.Server.Keepalive.PermitWithoutStream == nil {
+		permit := true
+		c.Server.Keepalive.PermitWithoutStream = &permit
+	}
+	if c.Server.ConnectRetries == 0 {
+		c.Server.ConnectRetries = 5
+	}
+	if c.Server.ConnectBackoff == 0 {
+		c.Server.ConnectBackoff = time.Second
+	}
+	if c.Tuning.InitialWindowSize == 0 {
+		c.Tuning.InitialWindowSize = 8 << 20
+	}
+	if c.Tuning.InitialConnWindowSize == 0 {
+		c.Tuning.InitialConnWindowSize = 64 << 20
+	}
+	if c.Tuning.ReadBufferSize == 0 {
+		c.Tuning.ReadBufferSize = 2 << 20
+	}
+	if c.Tuning.WriteBufferSize == 0 {
+		c.Tuning.WriteBufferSize = 2 << 20
+	}
+	if c.Tuning.MaxRecvMsgSize == 0 {
+		c.Tuning.MaxRecvMsgSize = 32 << 20
+	}
+	if c.Tuning.MaxSendMsgSize == 0 {
+		c.Tuning.MaxSendMsgSize = 32 << 20
+	}
+	if c.Stream.MaxBackoff == 0 {
+		c.Stream.MaxBackoff = 30 * time.Second
+	}
+	if c.Analyzers.PriceChange.ThresholdPct == 0 {
+		c.Analyzers.PriceChange.ThresholdPct = 10
+	}
+	if c.Analyzers.PriceChange.Window == 0 {
+		c.Analyzers.PriceChange.Window = 5 * time.Minute
+	}
+	if c.Analyzers.PriceChange.MinTrades == 0 {
+		c.Analyzers.PriceChange.MinTrades = 5
+	}
+	if c.Analyzers.PriceChange.MaxTracked == 0 {
+		c.Analyzers.PriceChange.MaxTracked = 100_000
+	}
+	if c.Output.MaxBlockEvents == 0 {
+		c.Output.MaxBlockEvents = 10_000
+	}
+	if c.Output.Kafka.KeyField == "" {
+		c.Output.Kafka.KeyField = "Transaction.Signature"
+	}
+	if c.Output.Kafka.MaxAttempts == 0 {
+		c.Output.Kafka.MaxAttempts = 10
+	}
+	if c.Output.Exec.Buffer == 0 {
+		c.Output.Exec.Buffer = 1024
+	}
+	if c.Health.MaxStaleness == 0 {
+		c.Health.MaxStaleness = time.Minute
+	}
+	if c.Output.FlushInterval == 0 {
+		c.Output.FlushInterval = 100 * time.Millisecond
+	}
+	if c.Analyzers.WashTrading.Window == 0 {
+		c.Analyzers.WashTrading.Window = time.Minute
+	}
+	if c.Analyzers.WashTrading.MinRoundTrips == 0 {
+		c.Analyzers.WashTrading.MinRoundTrips = 2
+	}
+	if c.Analyzers.WashTrading.MaxTracked == 0 {
+		c.Analyzers.WashTrading.MaxTracked = 100_000
+	}
+	if c.Alerts.RateFloor.ClearRate == 0 {
+		c.Alerts.RateFloor.ClearRate = 1.2 * c.Alerts.RateFloor.MinRate
+	}
+	if c.Alerts.RateFloor.For == 0 {
+		c.Alerts.RateFloor.For = time.Minute
+	}
+	if c.Stream.Checkpoint.Interval == 0 {
+		c.Stream.Checkpoint.Interval = 10 * time.Second
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
+	if c.Shutdown.GracePeriod == 0 {
+		c.Shutdown.GracePeriod = 10 * time.Second
+	}
+	if c.Debug.StallProfile.After == 0 {
+		c.Debug.StallProfile.After = time.Minute
+	}
+	if c.Debug.StallProfile.CPUDuration == 0 {
+		c.Debug.StallProfile.CPUDuration = 10 * time.Second
+	}
+	if c.RPC.Timeout == 0 {
+		c.RPC.Timeout = 5 * time.Second
+	}
+	if c.ProgramLogs.MaxLines == 0 {
+		c.ProgramLogs.MaxLines = 20
+	}
+}
+
+// The server.auth_scheme values.
+const (
+	AuthRaw    = "raw"
+	AuthBearer = "bearer"
+	AuthAPIKey = "x-api-key"
+)
+
+// streamTypes are the supported stream.type values.
+var streamTypes = []string{"dex_trades", "dex_orders", "dex_pools", "transactions", "transfers", "balances"}
+
+// The dedup.key values: the parts of an event that make its dedup key.
+const (
+	DedupSignature   = "signature"             // the transaction signature alone
+	DedupInstruction = "signature_instruction" // plus the instruction index
+	DedupAccount     = "signature_tx_account"  // plus the transaction and account index
+)
+
+// dedupKeys lists the dedup.key values each stream type supports, the
+// default first.
+var dedupKeys = map[string][]string{
+	"dex_trades":   {DedupInstruction, DedupSignature},
+	"dex_orders":   {DedupInstruction, DedupSignature},
+	"dex_pools":    {DedupInstruction, DedupSignature},
+	"transactions": {DedupSignature},
+	"transfers":    {DedupInstruction, DedupSignature},
+	"balances":     {DedupAccount, DedupSignature},
+}
+
+// filterStreams lists the stream types each filter applies to. The first
+// group is sent in the subscribe request, the rest are applied client-side.
+var filterStreams = map[string][]string{
+	"programs":  {"dex_trades", "dex_orders", "dex_pools", "transactions"},
+	"pools":     {"dex_trades", "dex_orders", "dex_pools"},
+	"tokens":    {"dex_trades", "dex_orders", "dex_pools", "transfers", "balances"},
+	"traders":   {"dex_trades", "dex_orders"},
+	"senders":   {"transfers"},
+	"receivers": {"transfers"},
+	"addresses": {"balances"},
+	"signers":   {"transactions"},
+
+	"order_states":                 {"dex_orders"},
+	"transfer_kind":                {"transfers"},
+	"transfer_min_amount":          {"transfers"},
+	"transfer_instruction_indexes": {"transfers"},
+	"min_sol_value":                {"transactions"},
+	"min_amount":                   {"dex_trades"},
+	"include_mints":                {"transfers", "balances"},
+	"exclude_mints":                {"transfers", "balances"},
+}
+
+// subscriptionFilterNames are the filters sent in subscribe requests.
+var subscriptionFilterNames = []string{"programs", "pools", "tokens", "traders", "senders", "receivers", "addresses", "signers"}
+
+// Validate checks the loaded configuration for mistakes that would
+// otherwise only show up once the stream is running, and reports all of
+// them at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Address == "" {
+		errs = append(errs, errors.New("server.address is empty"))
+	}
+	if ka := c.Server.Keepalive; ka.Time <= 0 || ka.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.keepalive.time (%s) and timeout (%s) must be positive", ka.Time, ka.Timeout))
+	} else if ka.Timeout >= ka.Time {
+		errs = append(errs, fmt.Errorf("server.keepalive.timeout (%s) must be shorter than server.keepalive.time (%s)", ka.Timeout, ka.Time))
+	}
+	if c.Server.ConnectBackoff < 0 {
+		errs = append(errs, fmt.Errorf("server.connect_backoff (%s) must be positive", c.Server.ConnectBackoff))
+	}
+	if c.Server.TokenProvider.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("server.token_provider.refresh_interval (%s) must be positive", c.Server.TokenProvider.RefreshInterval))
+	}
+	if c.Stream.IdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("stream.idle_timeout (%s) must be positive", c.Stream.IdleTimeout))
+	}
+	if sp := c.Debug.StallProfile; c.Stream.IdleTimeout > 0 && sp.Dir != "" && c.Stream.IdleTimeout >= sp.After {
+		errs = append(errs, fmt.Errorf("stream.idle_timeout (%s) must be shorter than debug.stall_profile.after (%s)", c.Stream.IdleTimeout, sp.After))
+	}
+	if c.Health.MaxStaleness < 0 {
+		errs = append(errs, fmt.Errorf("health.max_staleness (%s) must be positive", c.Health.MaxStaleness))
+	}
+	for _, st := range slices.Sorted(maps.Keys(c.Dedup.Key)) {
+		keys, ok := dedupKeys[st]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("dedup.key: unknown stream type %q", st))
+		case !slices.Contains(keys, c.Dedup.Key[st]):
+			errs = append(errs, fmt.Errorf("dedup.key for %s is %q, supported: %s", st, c.Dedup.Key[st], strings.Join(keys, "|")))
+		}
+	}
+	for _, name := range c.Reconnect.OnCodes {
+		if _, ok := ParseCode(name); !ok {
+			errs = append(errs, fmt.Errorf("unknown gRPC status code %q in reconnect.on_codes", name))
+		}
+	}
+	if c.Output.FlushInterval < 0 {
+		errs = append(errs, fmt.Errorf("output.flush_interval (%s) must be positive", c.Output.FlushInterval))
+	}
+	if c.Stream.LatencyInterval > 0 && c.RPC.URL == "" {
+		errs = append(errs, errors.New("stream.latency_interval needs rpc.url to look up block times"))
+	}
+	switch c.Server.AuthScheme {
+	case "", AuthRaw:
+	case AuthBearer, AuthAPIKey:
+		if c.Server.Authorization == "" && c.Server.TokenProvider.Type == "" {
+			errs = append(errs, fmt.Errorf("server.auth_scheme %q needs a token: set server.authorization or server.token_provider", c.Server.AuthScheme))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown server.auth_scheme %q, supported: %s|%s|%s", c.Server.AuthScheme, AuthRaw, AuthBearer, AuthAPIKey))
+	}
+	if h := c.Server.AuthHeader; h != "" && (h != strings.ToLower(h) || strings.HasPrefix(h, "grpc-") || strings.HasPrefix(h, ":") || strings.HasSuffix(h, "-bin")) {
+		errs = append(errs, fmt.Errorf("server.auth_header %q must be a lowercase metadata key, not reserved (grpc-*, :*) or binary (*-bin)", h))
+	}
+	if t := c.Server.TLS; (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, errors.New("server.tls.cert_file and server.tls.key_file must be set together"))
+	}
+	switch c.Server.Compression {
+	case "", "none", "gzip", "zstd":
+	default:
+		errs = append(errs, fmt.Errorf("unknown server.compression %q, supported: none|gzip|zstd", c.Server.Compression))
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, c.Logging.Level) {
+		errs = append(errs, fmt.Errorf("unknown logging.level %q, supported: debug|info|warn|error", c.Logging.Level))
+	}
+	switch c.Logging.Format {
+	case "", "terminal", "json", "logfmt":
+	default:
+		errs = append(errs, fmt.Errorf("unknown logging.format %q, supported: terminal|json|logfmt", c.Logging.Format))
+	}
+	if c.Stream.Type != "" && len(c.Stream.Types) > 0 {
+		errs = append(errs, errors.New("set either stream.type or stream.types, not both"))
+	}
+	types := c.StreamTypes()
+	if len(types) == 0 {
+		errs = append(errs, errors.New("no stream selected: set stream.type or stream.types, otherwise the client would subscribe to nothing"))
+	}
+	for i, st := range types {
+		switch {
+		case !slices.Contains(streamTypes, st):
+			errs = append(errs, fmt.Errorf("unknown stream type %q, supported: %s", st, strings.Join(streamTypes, "|")))
+		case slices.Contains(types[:i], st):
+			errs = append(errs, fmt.Errorf("stream type %q listed twice", st))
+		case !c.Filters.AllowEmpty && len(c.subscriptionFilters(st)) == 0:
+			errs = append(errs, fmt.Errorf("no filters set for stream type %q: this would subscribe to the whole stream; "+
+				"set at least one of filters.%s, or filters.allow_empty: true to do this on purpose",
+				st, strings.Join(streamFilterNames(st), ", filters.")))
+		}
+	}
+	if c.Filters.Strict == nil || *c.Filters.Strict {
+		errs = append(errs, c.checkAddresses()...)
+	}
+	if p := c.Output.Prefix; p != "" && !validName(p) {
+		errs = append(errs, fmt.Errorf("output.prefix %q may only contain letters, digits, '.', '_' and '-'", p))
+	}
+	if t := c.Output.Kafka.Topic; t != "" && (!validName(t) || len(t) > 249) {
+		errs = append(errs, fmt.Errorf("output.kafka.topic %q is not a valid Kafka topic: at most 249 letters, digits, '.', '_' and '-'", t))
+	}
+	for _, f := range []struct{ option, path string }{
+		{"output.file.path", c.Output.File.Path},
+		{"output.raw_dump", c.Output.RawDump},
+		{"output.kafka.spill_file", c.Output.Kafka.SpillFile},
+	} {
+		if name := filepath.Base(f.path); f.path != "" && len(name) > 255 {
+			errs = append(errs, fmt.Errorf("%s: file name %q is longer than 255 bytes", f.option, name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkAddresses reports every subscription filter value that doesn't
+// decode to a 32 byte account or program address, which the server would
+// silently never match.
+func (c *Config) checkAddresses() []error {
+	f := c.Filters
+	lists := map[string][]string{
+		"programs":  f.Programs,
+		"pools":     f.Pools,
+		"tokens":    f.Tokens,
+		"traders":   f.Traders,
+		"senders":   f.Senders,
+		"receivers": f.Receivers,
+		"addresses": f.Addresses,
+		"signers":   f.Signers,
+	}
+	var errs []error
+	for _, name := range subscriptionFilterNames {
+		for i, addr := range lists[name] {
+			raw, err := base58.Decode(addr)
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("filters.%s[%d] %q is not base58: %v (set filters.strict: false to send it anyway)", name, i, addr, err))
+			case len(raw) != 32:
+				errs = append(errs, fmt.Errorf("filters.%s[%d] %q decodes to %d bytes, not a 32 byte address (set filters.strict: false to send it anyway)", name, i, addr, len(raw)))
+			}
+		}
+	}
+	return errs
+}
+
+// UnusedFilters returns the filters that are set but ignored by all of the
+// configured stream types, typically left over from another stream type.
+func (c *Config) UnusedFilters() []string {
+	var unused []string
+	for _, name := range slices.Sorted(maps.Keys(filterStreams)) {
+		if !c.filterSet(name) {
+			continue
+		}
+		if !slices.ContainsFunc(c.StreamTypes(), func(st string) bool { return slices.Contains(filterStreams[name], st) }) {
+			unused = append(unused, "filters."+name)
+		}
+	}
+	return unused
+}
+
+// subscriptionFilters returns the names of the non-empty filters sent in
+// the subscribe request of streamType.
+func (c *Config) subscriptionFilters(streamType string) []string {
+	var set []string
+	for _, name := range streamFilterNames(streamType) {
+		if c.filterSet(name) {
+			set = append(set, name)
+		}
+	}
+	return set
+}
+
+// streamFilterNames returns the subscribe request filters of streamType.
+func streamFilterNames(streamType string) []string {
+	var names []string
+	for _, name := range subscriptionFilterNames {
+		if slices.Contains(filterStreams[name], streamType) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// filterSet reports whether the filter with the given YAML name is set.
+func (c *Config) filterSet(name string) bool {
+	f := c.Filters
+	switch name {
+	case "programs":
+		return len(f.Programs) > 0
+	case "pools":
+		return len(f.Pools) > 0
+	case "tokens":
+		return len(f.Tokens) > 0
+	case "traders":
+		return len(f.Traders) > 0
+	case "senders":
+		return len(f.Senders) > 0
+	case "receivers":
+		return len(f.Receivers) > 0
+	case "addresses":
+		return len(f.Addresses) > 0
+	case "signers":
+		return len(f.Signers) > 0
+	case "order_states":
+		return len(f.OrderStates) > 0
+	case "transfer_kind":
+		return f.TransferKind != ""
+	case "transfer_min_amount":
+		return f.TransferMinAmount > 0
+	case "transfer_instruction_indexes":
+		return len(f.TransferInstructionIndexes) > 0
+	case "min_sol_value":
+		return f.MinSOLValue > 0
+	case "min_amount":
+		return len(f.MinAmount) > 0
+	case "include_mints":
+		return len(f.IncludeMints) > 0
+	case "exclude_mints":
+		return len(f.ExcludeMints) > 0
+	}
+	return false
+}
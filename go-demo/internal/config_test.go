@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestLoadConfig(t *testing.T) {
+	// Keep the environment overrides out of the file values under test.
+	for _, name := range []string{"BITQUERY_SERVER_ADDRESS", "BITQUERY_SERVER_AUTHORIZATION", "BITQUERY_STREAM_TYPE", "LOG_LEVEL"} {
+		t.Setenv(name, "")
+	}
+
+	tests := []struct {
+		name    string
+		yaml    *string // nil: the file doesn't exist
+		wantErr bool
+		check   func(t *testing.T, c *Config)
+	}{
+		{name: "missing file", yaml: nil, wantErr: true},
+		{name: "malformed yaml", yaml: ptr("server: [address: \"x\"\n"), wantErr: true},
+		{name: "wrong type", yaml: ptr("stream:\n  max_messages: lots\n"), wantErr: true},
+		{
+			name: "unknown keys ignored",
+			yaml: ptr("bogus: 1\nserver:\n  address: \"localhost:50051\"\n  nope: true\nstream:\n  type: transfers\n"),
+			check: func(t *testing.T, c *Config) {
+				if c.Server.Address != "localhost:50051" {
+					t.Errorf("server.address = %q, want localhost:50051", c.Server.Address)
+				}
+				if c.Stream.Type != "transfers" {
+					t.Errorf("stream.type = %q, want transfers", c.Stream.Type)
+				}
+			},
+		},
+		{
+			name: "defaults applied",
+			yaml: ptr("stream:\n  type: dex_trades\n"),
+			check: func(t *testing.T, c *Config) {
+				if c.Tuning.MaxRecvMsgSize == 0 {
+					t.Error("tuning.max_recv_msg_size has no default")
+				}
+				if c.Stream.MaxBackoff == 0 {
+					t.Error("stream.max_backoff has no default")
+				}
+				if c.Output.Kafka.KeyField != "Transaction.Signature" {
+					t.Errorf("output.kafka.key_field = %q, want Transaction.Signature", c.Output.Kafka.KeyField)
+				}
+			},
+		},
+		{
+			name: "prefix applied",
+			yaml: ptr("stream:\n  type: dex_trades\noutput:\n  prefix: pipe-a\n  file:\n    path: out/trades.ndjson\n  kafka:\n    topic: corecast.trades\n    spill_file: kafka.spill\n"),
+			check: func(t *testing.T, c *Config) {
+				if c.Output.File.Path != filepath.Join("out", "pipe-a.trades.ndjson") {
+					t.Errorf("output.file.path = %q, want out/pipe-a.trades.ndjson", c.Output.File.Path)
+				}
+				if c.Output.Kafka.Topic != "pipe-a.corecast.trades" || c.Output.Kafka.SpillFile != "pipe-a.kafka.spill" {
+					t.Errorf("kafka topic %q, spill file %q, want them prefixed", c.Output.Kafka.Topic, c.Output.Kafka.SpillFile)
+				}
+				if c.Output.RawDump != "" {
+					t.Errorf("output.raw_dump = %q, want it left unset", c.Output.RawDump)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.yaml != nil {
+				if err := os.WriteFile(path, []byte(*tt.yaml), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := LoadConfig(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadConfig: expected an error, got %+v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func TestReconnectOn(t *testing.T) {
+	var c Config
+	c.applyDefaults()
+	for _, tt := range []struct {
+		code codes.Code
+		want bool
+	}{
+		{codes.Unavailable, true},
+		{codes.ResourceExhausted, true},
+		{codes.DeadlineExceeded, true},
+		{codes.Internal, false},
+		{codes.Unauthenticated, false},
+		{codes.OK, false},
+	} {
+		if got := c.ReconnectOn(tt.code); got != tt.want {
+			t.Errorf("default ReconnectOn(%s) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+
+	c.Reconnect.OnCodes = []string{"INTERNAL", "unavailable"}
+	if !c.ReconnectOn(codes.Internal) || !c.ReconnectOn(codes.Unavailable) || c.ReconnectOn(codes.ResourceExhausted) {
+		t.Errorf("ReconnectOn doesn't follow on_codes %v", c.Reconnect.OnCodes)
+	}
+	c.Reconnect.OnCodes = []string{"Unavailabel"}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), `"Unavailabel"`) {
+		t.Errorf("Validate accepted an unknown code: %v", err)
+	}
+}
+
+func TestValidatePrefixedNames(t *testing.T) {
+	for _, tt := range []struct {
+		prefix, topic, wantErr string
+	}{
+		{"pipe-a", "trades", ""},
+		{"pipe/a", "trades", "output.prefix"},
+		{"pipe a", "", "output.prefix"},
+		{"pipe-a", "trades:v1", "output.kafka.topic"},
+		{strings.Repeat("p", 245), "trades", "output.kafka.topic"},
+		{strings.Repeat("p", 250), "", "file name"},
+	} {
+		var c Config
+		c.Server.Address = "x"
+		c.Stream.Type = "dex_trades"
+		c.Filters.AllowEmpty = true
+		c.Output.Prefix = tt.prefix
+		c.Output.Kafka.Topic = tt.topic
+		c.Output.File.Path = "out/trades.ndjson"
+		c.applyDefaults()
+		c.applyPrefix()
+		err := c.Validate()
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("prefix %q, topic %q: %v", tt.prefix, tt.topic, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("prefix %q, topic %q: error %v, want one about %s", tt.prefix, tt.topic, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateIdleTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		idle, stallAfter time.Duration
+		ok               bool
+	}{
+		{0, time.Minute, true},
+		{30 * time.Second, time.Minute, true},
+		{time.Minute, time.Minute, false}, // the stall watchdog would fire first
+		{-time.Second, 0, false},
+	} {
+		var c Config
+		c.Server.Address = "x"
+		c.Stream.Type = "dex_trades"
+		c.Filters.AllowEmpty = true
+		c.Stream.IdleTimeout = tt.idle
+		if tt.stallAfter > 0 {
+			c.Debug.StallProfile.Dir = "profiles"
+			c.Debug.StallProfile.After = tt.stallAfter
+		}
+		c.applyDefaults()
+		if err := c.Validate(); (err == nil) != tt.ok {
+			t.Errorf("idle_timeout %s, stall_profile.after %s: err %v", tt.idle, tt.stallAfter, err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// dexPrograms are well-known Solana DEX programs. filters.dex_names accepts
+// either a program's name or its family, which selects all of the family's
+// programs.
+var dexPrograms = []struct{ name, family, address string }{
+	{"raydium_amm", "raydium", "675kPX9MHTjS2zt1qfr1NYHuzeLXfQM9H24wFSUt1Mp8"},
+	{"raydium_clmm", "raydium", "CAMMCzo5YL8w4VFF8KVHrK22GGUsp5VTaW7grrKgrWqK"},
+	{"raydium_cpmm", "raydium", "CPMMoo8L3F4NbTegBCKVNunggL7H1ZpdTHKxQB5qKP1C"},
+	{"raydium_launchpad", "raydium", "LanMV9sAd7wArD4vJFi2qDdfnVhFxYSUg6eADduJ3uj"},
+	{"orca_whirlpool", "orca", "whirLbMiicVdio4qvUfM5KAg6Ct8VwpYzGff3uctyCc"},
+	{"orca_token_swap", "orca", "9W959DqEETiGZocYWCQPaJ6sBmUzgfxXfqGeTEdp3aQP"},
+	{"meteora_dlmm", "meteora", "LBUZKhRxPF3XUpBCjp4YzTKgLccjZhTSDM9YuVaPwxo"},
+	{"meteora_amm", "meteora", "Eo7WjKq67rjJQSZxS6z3YkapzY3eMj6Xy8X5EQVn5UaB"},
+	{"pump_fun", "pump", "6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P"},
+	{"pump_swap", "pump", "pAMMBay6oceH9fJKBRHGP5D4bD4sWpmSwMn52FMfXEA"},
+	{"jupiter", "jupiter", "JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4"},
+	{"phoenix", "phoenix", "PhoeNiXZ8ByJGLkxNfZRnkUfjvmuYqLR89jjFHGqdXY"},
+	{"openbook_v2", "openbook", "opnb2LAfJYbRMAHHvqjCwQxanZn7ReEHp1k81EohpZb"},
+	{"lifinity_v2", "lifinity", "2wT8Yq49kHgDzXuPxZSaeLaH1qbmGXtEyPy64bL7aD3c"},
+}
+
+// DexName returns the name of a well-known DEX program address, or "".
+func DexName(address string) string {
+	for _, p := range dexPrograms {
+		if p.address == address {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// resolveDexNames appends the program addresses of filters.dex_names to
+// filters.programs, skipping those already listed.
+func (c *Config) resolveDexNames() error {
+	f := &c.Filters
+	for _, name := range f.DexNames {
+		found := false
+		for _, p := range dexPrograms {
+			if !strings.EqualFold(name, p.name) && !strings.EqualFold(name, p.family) {
+				continue
+			}
+			found = true
+			if !slices.Contains(f.Programs, p.address) {
+				f.Programs = append(f.Programs, p.address)
+			}
+		}
+		if !found {
+			return fmt.Errorf("filters.dex_names: unknown DEX %q, known: %s", name, strings.Join(dexNames(), "|"))
+		}
+	}
+	return nil
+}
+
+// dexNames returns the accepted filters.dex_names values, families first.
+func dexNames() []string {
+	var families, names []string
+	for _, p := range dexPrograms {
+		if p.family != p.name && !slices.Contains(families, p.family) {
+			families = append(families, p.family)
+		}
+		names = append(names, p.name)
+	}
+	return append(families, names...)
+}
@@ -0,0 +1,22 @@
+// Package encode formats the binary values of the stream, addresses and
+// transaction signatures, for the client's output. Values used as map keys
+// or compared with configured addresses stay base58 regardless, since the
+// config is written in base58.
+package encode
+
+import "github.com/mr-tron/base58"
+
+// Address returns the base58 form of an address, or "" when it is nil or
+// empty, which records tagged omitempty leave out.
+func Address(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return base58.Encode(b)
+}
+
+// Signature returns the base58 form of a transaction signature, or "" when
+// it is nil or empty.
+func Signature(b []byte) string {
+	return Address(b)
+}
@@ -0,0 +1,311 @@
+// Package mockserver is an in-memory CoreCast server for local development
+// and tests. It serves every stream type with canned messages, so the client
+// can be run without credentials, see cmd/mockserver. Messages use the first
+// address of each filter in the subscribe request where they have one, so
+// filter match counts and client-side filters see them. Signatures depend
+// only on the stream type and the message number (see Signature), so a
+// re-subscribe resends the same ones.
+package mockserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"time"
+
+	proto "github.com/bitquery/streaming_protobuf/v2/solana/corecast/stream"
+	solana_messages "github.com/bitquery/streaming_protobuf/v2/solana/messages"
+	log "github.com/inconshreveable/log15"
+	"github.com/mr-tron/base58"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// slotTime is the target duration of a Solana slot, which the mock's slot
+// numbers advance at.
+const slotTime = 400 * time.Millisecond
+
+var (
+	wrappedSOL = &solana_messages.Currency{Symbol: "WSOL", Name: "Wrapped SOL", Decimals: 9, Wrapped: true, Fungible: true, MintAddress: mustAddress("So11111111111111111111111111111111111111112")}
+	usdc       = &solana_messages.Currency{Symbol: "USDC", Name: "USD Coin", Decimals: 6, Fungible: true, MintAddress: mustAddress("EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v")}
+	nativeSOL  = &solana_messages.Currency{Symbol: "SOL", Name: "Solana", Decimals: 9, Native: true}
+	pumpFun    = mustAddress("6EF8rrecthR5Dkzon8Nwu78hRvfCKubJ14M5uBEwF6P")
+)
+
+// Options configure a Server.
+type Options struct {
+	// Interval is the delay between the messages of each stream.
+	Interval time.Duration
+	// EndAfter ends every stream after this many messages, 0 = never.
+	EndAfter uint64
+	// EndCode is the status a stream ends with after EndAfter messages;
+	// codes.OK ends it cleanly.
+	EndCode codes.Code
+	// Token, if set, is the metadata required from clients under
+	// AuthHeader ("authorization" if empty).
+	Token      string
+	AuthHeader string
+}
+
+// Server implements the CoreCast service; register it with
+// proto.RegisterCoreCastServer.
+type Server struct {
+	proto.UnimplementedCoreCastServer
+	interval time.Duration
+	endAfter uint64
+	endCode  codes.Code
+	token    string
+	header   string
+	started  time.Time
+}
+
+// New returns a Server whose slot numbers start advancing now.
+func New(opts Options) *Server {
+	if opts.AuthHeader == "" {
+		opts.AuthHeader = "authorization"
+	}
+	return &Server{
+		interval: opts.Interval,
+		endAfter: opts.EndAfter,
+		endCode:  opts.EndCode,
+		token:    opts.Token,
+		header:   opts.AuthHeader,
+		started:  time.Now(),
+	}
+}
+
+// serve sends next(1), next(2), ... every interval until the client goes
+// away or EndAfter is reached.
+func serve[T any](s *Server, stream string, strm grpc.ServerStreamingServer[T], next func(n uint64) *T) error {
+	ctx := strm.Context()
+	if err := s.authorize(ctx); err != nil {
+		return err
+	}
+	var from string
+	if p, ok := peer.FromContext(ctx); ok {
+		from = p.Addr.String()
+	}
+	log.Info("subscribed", "stream", stream, "peer", from)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for n := uint64(1); ; n++ {
+		select {
+		case <-ctx.Done():
+			log.Info("unsubscribed", "stream", stream, "peer", from, "sent", n-1)
+			return nil
+		case <-ticker.C:
+		}
+		if err := strm.Send(next(n)); err != nil {
+			return err
+		}
+		if s.endAfter > 0 && n >= s.endAfter {
+			log.Info("ending stream", "stream", stream, "peer", from, "sent", n, "code", s.endCode)
+			if s.endCode == codes.OK {
+				return nil
+			}
+			return status.Errorf(s.endCode, "mock: stream ended after %d messages", n)
+		}
+	}
+}
+
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if got := md.Get(s.header); len(got) == 0 || got[0] != s.token {
+		return status.Errorf(codes.Unauthenticated, "mock: missing or wrong %s", s.header)
+	}
+	return nil
+}
+
+// block returns the current slot, advancing at the pace of a real chain.
+func (s *Server) block() *proto.Block {
+	return &proto.Block{Slot: 300_000_000 + uint64(time.Since(s.started)/slotTime)}
+}
+
+func tx(stream string, n uint64) *proto.TransactionInfo {
+	return &proto.TransactionInfo{
+		Index:     uint32(n % 1000),
+		Signature: Signature(stream, n),
+		Status:    &solana_messages.TransactionStatus{Success: true},
+		Header:    &solana_messages.TransactionHeader{Fee: 5000},
+	}
+}
+
+func (s *Server) DexTrades(req *proto.SubscribeTradesRequest, strm grpc.ServerStreamingServer[proto.DexTradeEventMessage]) error {
+	program, pool, token, trader := first(req.GetProgram(), pumpFun), first(req.GetPool(), address("pool")), currency(req.GetToken(), usdc), first(req.GetTrader(), address("trader"))
+	return serve(s, "dex_trades", strm, func(n uint64) *proto.DexTradeEventMessage {
+		return &proto.DexTradeEventMessage{
+			Block:       s.block(),
+			Transaction: tx("dex_trades", n),
+			Trade: &solana_messages.DexTradeEvent{
+				Dex:    &solana_messages.DexInfo{ProgramAddress: program, ProtocolName: "mock", ProtocolFamily: "mock"},
+				Market: &solana_messages.DexMarket{MarketAddress: pool, BaseCurrency: token, QuoteCurrency: wrappedSOL},
+				Buy:    &solana_messages.TradeSide{Amount: 1_000_000 * (n%50 + 1), Currency: token, Account: &solana_messages.Account{Address: trader}},
+				Sell:   &solana_messages.TradeSide{Amount: 10_000_000 * (n%50 + 1), Currency: wrappedSOL, Account: &solana_messages.Account{Address: trader}},
+			},
+		}
+	})
+}
+
+func (s *Server) DexOrders(req *proto.SubscribeOrdersRequest, strm grpc.ServerStreamingServer[proto.DexOrderEventMessage]) error {
+	program, pool, token, trader := first(req.GetProgram(), pumpFun), first(req.GetPool(), address("pool")), currency(req.GetToken(), usdc), first(req.GetTrader(), address("trader"))
+	return serve(s, "dex_orders", strm, func(n uint64) *proto.DexOrderEventMessage {
+		return &proto.DexOrderEventMessage{
+			Block:       s.block(),
+			Transaction: tx("dex_orders", n),
+			Order: &solana_messages.DexOrderEvent{
+				Type:   solana_messages.DexOrderEventType(n % 3),
+				Dex:    &solana_messages.DexInfo{ProgramAddress: program, ProtocolName: "mock", ProtocolFamily: "mock"},
+				Market: &solana_messages.DexMarket{MarketAddress: pool, BaseCurrency: token, QuoteCurrency: wrappedSOL},
+				Order: &solana_messages.DexOrder{
+					OrderId:     address(fmt.Sprint("order", n/3))[:16],
+					BuySide:     n%2 == 0,
+					LimitPrice:  100 + n%10,
+					LimitAmount: 1_000_000,
+					Account:     trader,
+					Mint:        token.MintAddress,
+				},
+			},
+		}
+	})
+}
+
+func (s *Server) DexPools(req *proto.SubscribePoolsRequest, strm grpc.ServerStreamingServer[proto.DexPoolEventMessage]) error {
+	program, pool, token := first(req.GetProgram(), pumpFun), first(req.GetPool(), address("pool")), currency(req.GetToken(), usdc)
+	return serve(s, "dex_pools", strm, func(n uint64) *proto.DexPoolEventMessage {
+		change := int64(n%100) - 50
+		return &proto.DexPoolEventMessage{
+			Block:       s.block(),
+			Transaction: tx("dex_pools", n),
+			PoolEvent: &solana_messages.DexPoolEvent{
+				Dex:           &solana_messages.DexInfo{ProgramAddress: program, ProtocolName: "mock", ProtocolFamily: "mock"},
+				Market:        &solana_messages.DexMarket{MarketAddress: pool, BaseCurrency: token, QuoteCurrency: wrappedSOL},
+				BaseCurrency:  &solana_messages.PoolSide{ChangeAmount: change * 1_000_000, PostAmount: 1_000_000_000},
+				QuoteCurrency: &solana_messages.PoolSide{ChangeAmount: -change * 10_000_000, PostAmount: 50_000_000_000},
+			},
+		}
+	})
+}
+
+func (s *Server) Transactions(req *proto.SubscribeTransactionsRequest, strm grpc.ServerStreamingServer[proto.ParsedTransactionMessage]) error {
+	program, signer := first(req.GetProgram(), pumpFun), first(req.GetSigner(), address("signer"))
+	return serve(s, "transactions", strm, func(n uint64) *proto.ParsedTransactionMessage {
+		sig := Signature("transactions", n)
+		return &proto.ParsedTransactionMessage{
+			Block: s.block(),
+			Transaction: &solana_messages.ParsedIdlTransaction{
+				Index:     uint32(n % 1000),
+				Signature: sig,
+				Status:    &solana_messages.TransactionStatus{Success: true},
+				Header: &solana_messages.TransactionHeader{
+					Fee:        5000,
+					FeePayer:   signer,
+					Signer:     signer,
+					Signatures: [][]byte{sig},
+					Accounts: []*solana_messages.Account{
+						{Address: signer, IsSigner: true, IsWritable: true},
+						{Address: address("receiver"), IsWritable: true},
+					},
+				},
+				TotalBalanceUpdates: []*solana_messages.BalanceUpdate{
+					{PreBalance: 10_000_000_000, PostBalance: 10_000_000_000 - 5000 - 1_000_000*(n%100), AccountIndex: 0},
+					{PreBalance: 0, PostBalance: 1_000_000 * (n % 100), AccountIndex: 1},
+				},
+				ParsedIdlInstructions: []*solana_messages.ParsedIdlInstruction{{
+					Program: &solana_messages.ParsedIdlProgram{Address: program, Parsed: true, Name: "mock", Method: "swap"},
+					Logs:    []string{"Program log: Instruction: Swap", fmt.Sprintf("Program log: mock message %d", n)},
+				}},
+			},
+		}
+	})
+}
+
+func (s *Server) Transfers(req *proto.SubscribeTransfersRequest, strm grpc.ServerStreamingServer[proto.TransferTxMessage]) error {
+	sender, receiver := first(req.GetSender(), address("sender")), first(req.GetReceiver(), address("receiver"))
+	token := currency(req.GetToken(), usdc)
+	return serve(s, "transfers", strm, func(n uint64) *proto.TransferTxMessage {
+		cur := token
+		if n%2 == 0 {
+			cur = nativeSOL
+		}
+		return &proto.TransferTxMessage{
+			Block:       s.block(),
+			Transaction: tx("transfers", n),
+			Transfer: &solana_messages.Transfer{
+				InstructionIndex: uint32(n % 3),
+				Amount:           1_000_000 * (n%20 + 1),
+				Sender:           &solana_messages.Account{Address: sender},
+				Receiver:         &solana_messages.Account{Address: receiver},
+				Currency:         cur,
+			},
+		}
+	})
+}
+
+func (s *Server) Balances(req *proto.SubscribeBalanceUpdateRequest, strm grpc.ServerStreamingServer[proto.BalanceUpdateTxMessage]) error {
+	account, token := first(req.GetAddress(), address("account")), currency(req.GetToken(), usdc)
+	return serve(s, "balances", strm, func(n uint64) *proto.BalanceUpdateTxMessage {
+		t := tx("balances", n)
+		t.Header.Accounts = []*solana_messages.Account{{
+			Address: account,
+			Token:   &solana_messages.TokenInfo{Mint: token.MintAddress, Owner: address("owner"), Decimals: token.Decimals},
+		}}
+		return &proto.BalanceUpdateTxMessage{
+			Block:       s.block(),
+			Transaction: t,
+			BalanceUpdate: &solana_messages.TokenBalanceUpdate{
+				BalanceUpdate: &solana_messages.BalanceUpdate{PreBalance: 1_000_000 * n, PostBalance: 1_000_000 * (n + 1)},
+				Currency:      token,
+			},
+		}
+	})
+}
+
+// first returns the first address of a request filter, or fallback when
+// the filter is empty or the address is not base58.
+func first(f *proto.AddressFilter, fallback []byte) []byte {
+	if a := f.GetAddresses(); len(a) > 0 {
+		if b, err := base58.Decode(a[0]); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
+// currency returns fallback, with the mint of the request's token filter
+// if set.
+func currency(f *proto.AddressFilter, fallback *solana_messages.Currency) *solana_messages.Currency {
+	mint := first(f, nil)
+	if mint == nil {
+		return fallback
+	}
+	return &solana_messages.Currency{Symbol: "MOCK", Name: "Mock token", Decimals: 6, Fungible: true, MintAddress: mint}
+}
+
+// address returns a fake but well-formed 32 byte address derived from seed.
+func address(seed string) []byte {
+	h := sha256.Sum256([]byte(seed))
+	return h[:]
+}
+
+// Signature returns the 64 byte signature of message n (from 1) of a
+// stream type.
+func Signature(stream string, n uint64) []byte {
+	h := sha512.Sum512([]byte(fmt.Sprint(stream, n)))
+	return h[:]
+}
+
+func mustAddress(s string) []byte {
+	b, err := base58.Decode(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}